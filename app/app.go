@@ -15,8 +15,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fsnotify/fsnotify"
 	contract "github.com/slidebolt/sb-contract"
 	domain "github.com/slidebolt/sb-domain"
 	messenger "github.com/slidebolt/sb-messenger-sdk"
@@ -34,11 +35,37 @@ const PluginID = "plugin-frigate"
 
 type FrigateConfig struct {
 	URL       string     `json:"url"`
+	Name      string     `json:"name,omitempty"`
 	Go2RTCURL string     `json:"go2rtc_url,omitempty"`
 	Username  string     `json:"username,omitempty"`
 	Password  string     `json:"password,omitempty"`
 	Timeout   int        `json:"timeout_ms,omitempty"`
 	MQTT      MQTTConfig `json:"mqtt,omitempty"`
+
+	UsernameFile string `json:"username_file,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+
+	Snapshot SnapshotOptions `json:"snapshot,omitempty"`
+	Media    MediaConfig     `json:"media,omitempty"`
+	Archive  ArchiveConfig   `json:"archive,omitempty"`
+
+	StreamHealth StreamHealthConfig `json:"stream_health,omitempty"`
+	RTSP         RTSPConfig         `json:"rtsp,omitempty"`
+	Deletion     DeletionConfig     `json:"deletion,omitempty"`
+	Cameras      CamerasConfig      `json:"cameras,omitempty"`
+	Labels       LabelsConfig       `json:"labels,omitempty"`
+	Counters     CountersConfig     `json:"counters,omitempty"`
+	StaleEvents  StaleEventsConfig  `json:"stale_events,omitempty"`
+	Occupancy    OccupancyConfig    `json:"occupancy,omitempty"`
+	Speed        SpeedConfig        `json:"speed,omitempty"`
+
+	ReconcileIntervalSeconds int `json:"reconcile_interval_seconds,omitempty"`
+	ReconcileJitterSeconds   int `json:"reconcile_jitter_seconds,omitempty"`
+
+	Instances []FrigateConfig `json:"instances,omitempty"`
+
+	source     string
+	readErrors []string
 }
 
 type MQTTConfig struct {
@@ -47,6 +74,9 @@ type MQTTConfig struct {
 	User        string `json:"user,omitempty"`
 	Password    string `json:"password,omitempty"`
 	TopicPrefix string `json:"topic_prefix,omitempty"`
+
+	UserFile     string `json:"user_file,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
 }
 
 type FeatureToggle struct {
@@ -81,12 +111,21 @@ type CameraConfig struct {
 	Objects    ObjectConfig    `json:"objects,omitempty"`
 	MotionMask []interface{}   `json:"motion_mask,omitempty"`
 	Zones      map[string]Zone `json:"zones,omitempty"`
+	Live       LiveConfig      `json:"live,omitempty"`
+}
+
+// LiveConfig names the go2rtc streams Frigate's UI uses for a camera.
+type LiveConfig struct {
+	StreamName string            `json:"stream_name,omitempty"`
+	Streams    map[string]string `json:"streams,omitempty"`
 }
 
 type Zone struct {
-	Name        string   `json:"name"`
-	Coordinates any      `json:"coordinates,omitempty"`
-	Objects     []string `json:"objects,omitempty"`
+	Name          string   `json:"name"`
+	Coordinates   any      `json:"coordinates,omitempty"`
+	Objects       []string `json:"objects,omitempty"`
+	LoiteringTime int      `json:"loitering_time,omitempty"`
+	Distances     []any    `json:"distances,omitempty"`
 }
 
 type ReviewConfig struct {
@@ -99,17 +138,80 @@ type ObjectConfig struct {
 }
 
 type Event struct {
-	ID                 string    `json:"id"`
-	Label              string    `json:"label"`
-	Camera             string    `json:"camera"`
-	StartTime          float64   `json:"start_time"`
-	EndTime            float64   `json:"end_time,omitempty"`
-	FalsePositive      bool      `json:"false_positive"`
-	Zones              []string  `json:"zones"`
-	HasClip            bool      `json:"has_clip"`
-	HasSnapshot        bool      `json:"has_snapshot"`
-	RetainIndefinitely bool      `json:"retain_indefinitely"`
-	Data               EventData `json:"data"`
+	ID                     string    `json:"id"`
+	Label                  string    `json:"label"`
+	SubLabel               SubLabel  `json:"sub_label,omitempty"`
+	Camera                 string    `json:"camera"`
+	StartTime              float64   `json:"start_time"`
+	EndTime                float64   `json:"end_time,omitempty"`
+	FalsePositive          bool      `json:"false_positive"`
+	Score                  float64   `json:"score,omitempty"`
+	TopScore               float64   `json:"top_score,omitempty"`
+	Area                   int       `json:"area,omitempty"`
+	Stationary             bool      `json:"stationary,omitempty"`
+	MotionlessCount        int       `json:"motionless_count,omitempty"`
+	MaxSeverity            string    `json:"max_severity,omitempty"`
+	CurrentEstimatedSpeed  float64   `json:"current_estimated_speed,omitempty"`
+	AverageEstimatedSpeed  float64   `json:"average_estimated_speed,omitempty"`
+	Zones                  []string  `json:"zones"`
+	CurrentZones           []string  `json:"current_zones,omitempty"`
+	EnteredZones           []string  `json:"entered_zones,omitempty"`
+	HasClip                bool      `json:"has_clip"`
+	HasSnapshot            bool      `json:"has_snapshot"`
+	RetainIndefinitely     bool      `json:"retain_indefinitely"`
+	RecognizedLicensePlate string    `json:"recognized_license_plate,omitempty"`
+	Data                   EventData `json:"data"`
+}
+
+// SubLabel accepts Frigate's sub_label, which is null, a plain string or a
+// [name, score] pair depending on the Frigate version.
+type SubLabel string
+
+func (s *SubLabel) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = SubLabel(name)
+		return nil
+	}
+	var pair []any
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	*s = ""
+	if len(pair) > 0 {
+		if name, ok := pair[0].(string); ok {
+			*s = SubLabel(name)
+		}
+	}
+	return nil
+}
+
+// bestScore returns the highest score Frigate reported for the event, from
+// either the MQTT payload or the REST data block.
+func (e Event) bestScore() float64 {
+	score := e.TopScore
+	for _, s := range []float64{e.Score, e.Data.TopScore, e.Data.Score} {
+		if s > score {
+			score = s
+		}
+	}
+	return score
+}
+
+// allZones returns every zone the event has been seen in.
+func (e Event) allZones() []string {
+	seen := make(map[string]struct{})
+	var zones []string
+	for _, list := range [][]string{e.Zones, e.EnteredZones, e.CurrentZones} {
+		for _, zone := range list {
+			if _, ok := seen[zone]; ok {
+				continue
+			}
+			seen[zone] = struct{}{}
+			zones = append(zones, zone)
+		}
+	}
+	return zones
 }
 
 type EventData struct {
@@ -127,6 +229,7 @@ type CameraState struct {
 	RecordEnabled    bool     `json:"record_enabled"`
 	SnapshotsEnabled bool     `json:"snapshots_enabled"`
 	Zones            []string `json:"zones"`
+	Area             string   `json:"area,omitempty"`
 	LastEvent        *Event   `json:"last_event,omitempty"`
 	LastError        string   `json:"last_error,omitempty"`
 }
@@ -136,16 +239,27 @@ type AvailabilityState struct {
 }
 
 type StreamState struct {
-	URL    string `json:"url"`
-	Format string `json:"format,omitempty"`
-	Kind   string `json:"kind,omitempty"`
-	Online bool   `json:"online"`
+	URL         string           `json:"url"`
+	Format      string           `json:"format,omitempty"`
+	Kind        string           `json:"kind,omitempty"`
+	Online      bool             `json:"online"`
+	Health      string           `json:"health,omitempty"`
+	Bitrate     int64            `json:"bitrate_bps,omitempty"`
+	Consumers   int              `json:"consumers"`
+	Stream      string           `json:"stream,omitempty"`
+	Camera      string           `json:"camera,omitempty"`
+	Producers   []StreamProducer `json:"producers,omitempty"`
+	Codecs      []string         `json:"codecs,omitempty"`
+	Resolution  string           `json:"resolution,omitempty"`
+	Auth        bool             `json:"auth,omitempty"`
+	Backchannel bool             `json:"backchannel,omitempty"`
 }
 
 type ImageState struct {
-	URL    string `json:"url"`
-	Format string `json:"format,omitempty"`
-	Online bool   `json:"online"`
+	URL     string `json:"url"`
+	Format  string `json:"format,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+	Online  bool   `json:"online"`
 }
 
 type EventSensorState struct {
@@ -177,15 +291,29 @@ func init() {
 	domain.Register("frigate_camera_status", CameraState{})
 	domain.Register("frigate_availability", AvailabilityState{})
 	domain.Register("frigate_stream", StreamState{})
+	domain.Register("frigate_stream_status", StreamStatusState{})
 	domain.Register("frigate_image", ImageState{})
+	domain.Register("frigate_clip", ClipState{})
 	domain.Register("frigate_event_sensor", EventSensorState{})
 	domain.Register("frigate_status_sensor", StatusSensorState{})
+	domain.Register("frigate_window_counts", WindowCountsState{})
+	domain.Register("frigate_object_counts", ObjectCountsState{})
+	domain.Register("frigate_manual_event", ManualEventState{})
+	domain.Register("frigate_exports", ExportsState{})
+	domain.Register("frigate_diagnostics", DiagnosticsState{})
 	domain.RegisterCommand("frigate_camera_enable_detect", CameraEnableDetect{})
 	domain.RegisterCommand("frigate_camera_disable_detect", CameraDisableDetect{})
 	domain.RegisterCommand("frigate_camera_enable_record", CameraEnableRecord{})
 	domain.RegisterCommand("frigate_camera_disable_record", CameraDisableRecord{})
 	domain.RegisterCommand("frigate_camera_enable_snapshots", CameraEnableSnapshots{})
 	domain.RegisterCommand("frigate_camera_disable_snapshots", CameraDisableSnapshots{})
+	domain.RegisterCommand("frigate_create_event", CameraCreateEvent{})
+	domain.RegisterCommand("frigate_end_event", CameraEndEvent{})
+	domain.RegisterCommand("frigate_export", CameraExport{})
+	domain.RegisterCommand("frigate_webrtc_offer", CameraWebRTCOffer{})
+	domain.RegisterCommand("frigate_stream_url", CameraStreamURL{})
+	domain.RegisterCommand("frigate_talkback", CameraTalkback{})
+	domain.RegisterCommand("frigate_reconcile", PluginReconcile{})
 }
 
 type FrigateClient struct {
@@ -195,6 +323,7 @@ type FrigateClient struct {
 	HTTPClient *http.Client
 }
 
+// ReconcileInterval is the default time between camera reconciles.
 const ReconcileInterval = 10 * time.Minute
 
 func NewFrigateClient(baseURL, username, password string, timeout time.Duration) *FrigateClient {
@@ -236,7 +365,42 @@ func (c *FrigateClient) post(ctx context.Context, path string, body []byte) (*ht
 	return c.HTTPClient.Do(req)
 }
 
-func (c *FrigateClient) GetConfig(ctx context.Context) (map[string]CameraConfig, error) {
+func (c *FrigateClient) put(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+// ServerConfig is the part of /api/config the plugin reads.
+type ServerConfig struct {
+	Cameras map[string]CameraConfig `json:"cameras"`
+	Go2RTC  struct {
+		Streams map[string]json.RawMessage `json:"streams,omitempty"`
+	} `json:"go2rtc"`
+	UI struct {
+		UnitSystem string `json:"unit_system,omitempty"`
+	} `json:"ui"`
+}
+
+// StreamNames lists the streams defined in Frigate's go2rtc section.
+func (c ServerConfig) StreamNames() []string {
+	names := make([]string, 0, len(c.Go2RTC.Streams))
+	for name := range c.Go2RTC.Streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *FrigateClient) GetServerConfig(ctx context.Context) (*ServerConfig, error) {
 	resp, err := c.get(ctx, "/api/config")
 	if err != nil {
 		return nil, fmt.Errorf("get config: %w", err)
@@ -248,13 +412,19 @@ func (c *FrigateClient) GetConfig(ctx context.Context) (map[string]CameraConfig,
 		return nil, fmt.Errorf("get config: HTTP %d: %s", resp.StatusCode, string(body))
 	}
 
-	var config struct {
-		Cameras map[string]CameraConfig `json:"cameras"`
-	}
+	var config ServerConfig
 	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
 		return nil, fmt.Errorf("decode config: %w", err)
 	}
 
+	return &config, nil
+}
+
+func (c *FrigateClient) GetConfig(ctx context.Context) (map[string]CameraConfig, error) {
+	config, err := c.GetServerConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
 	return config.Cameras, nil
 }
 
@@ -320,31 +490,66 @@ func (c *FrigateClient) SetSnapshots(ctx context.Context, camera string, enabled
 }
 
 type App struct {
-	msg        messenger.Messenger
-	store      storage.Storage
-	cmds       *messenger.Commands
-	subs       []messenger.Subscription
-	config     FrigateConfig
-	client     *FrigateClient
-	mqttClient mqtt.Client
-	ctx        context.Context
-	cancel     context.CancelFunc
-	mu         sync.Mutex
-	runtime    map[string]*cameraRuntime
-	newTicker  func(time.Duration) *time.Ticker
+	msg          messenger.Messenger
+	store        storage.Storage
+	cmds         *messenger.Commands
+	subs         []messenger.Subscription
+	config       FrigateConfig
+	client       *FrigateClient
+	go2rtc       *Go2RTCClient
+	streams      streamCatalog
+	cameras      map[string]CameraConfig
+	unitSystem   string
+	streamHealth map[string]streamSample
+	mqttClient   mqtt.Client
+	media        *mediaService
+	archive      *archiver
+	name         string
+	missing      map[string]int
+	instances    []*App
+	reconcileMu  sync.Mutex
+	reloadMu     *sync.RWMutex // shared by all instances
+	loops        sync.WaitGroup
+	source       FrigateConfig
+	watcher      *fsnotify.Watcher
+	closed       bool
+	diagnostics  DiagnosticsState
+	ctx          context.Context
+	cancel       context.CancelFunc
+	mu           sync.Mutex
+	runtime      map[string]*cameraRuntime
+	dirty        map[string]struct{} // cameras with unsaved runtime
+	newTicker    func(time.Duration) *time.Ticker
+	after        func(time.Duration) <-chan time.Time
+	now          func() time.Time
+
+	// Export tracking, see watchExports and refreshExports.
+	exportStarts       int
+	watchingExports    bool
+	exportsUnsupported bool
 }
 
 type labelRuntime struct {
 	Count     int
 	Active    map[string]Event
+	Seen      map[string]time.Time // last update of each active event
 	LastEvent *Event
+	Windows   windowCounter
+	Occupied  bool      // debounced occupancy, see updateOccupancyLocked
+	Pending   time.Time // when the raw occupancy started to differ
 }
 
 type cameraRuntime struct {
 	Labels    map[string]struct{}
 	ByLabel   map[string]*labelRuntime
+	Zones     map[string]windowCounter
+	Loiter    map[string]map[string]*loiterEntry // zone -> event ID
+	Speeds    map[string]*zoneSpeed
+	Reaped    int
 	LastEvent *Event
 	LastError string
+	Manual    ManualEventState
+	Exports   ExportsState
 }
 
 type streamSpec struct {
@@ -353,12 +558,16 @@ type streamSpec struct {
 	Path   string
 	Format string
 	Kind   string
+	Scheme string
 }
 
 func New() *App {
 	return &App{
 		runtime:   make(map[string]*cameraRuntime),
+		reloadMu:  new(sync.RWMutex),
 		newTicker: time.NewTicker,
+		after:     time.After,
+		now:       time.Now,
 	}
 }
 
@@ -384,82 +593,176 @@ func (a *App) OnStart(deps map[string]json.RawMessage) (json.RawMessage, error)
 	}
 	a.store = storeClient
 
-	if err := a.loadConfig(); err != nil {
-		log.Printf("plugin-frigate: warning: could not load config: %v", err)
-	}
+	a.loadConfig()
+
+	a.setupInstances()
 
-	if a.config.URL != "" {
-		timeout := a.config.Timeout
-		if timeout == 0 {
-			timeout = 30000
+	if a.config.Media.Listen != "" {
+		media, err := newMediaService(a.config.Media, a.fetchMedia)
+		if err == nil {
+			err = media.start()
+		}
+		if err != nil {
+			log.Printf("plugin-frigate: media proxy disabled: %v", err)
+		} else {
+			a.media = media
+			for _, inst := range a.instances {
+				inst.media = media
+			}
 		}
-		a.client = NewFrigateClient(
-			a.config.URL,
-			a.config.Username,
-			a.config.Password,
-			time.Duration(timeout)*time.Millisecond,
-		)
+	}
+
+	for _, inst := range a.instances {
+		inst.initInstance()
 	}
 
 	a.cmds = messenger.NewCommands(msg, domain.LookupCommand)
-	sub, err := a.cmds.Receive(PluginID+".>", a.handleCommand)
+	sub, err := a.cmds.ReceiveMessage(PluginID+".>", a.routeCommand)
 	if err != nil {
 		return nil, fmt.Errorf("subscribe commands: %w", err)
 	}
 	a.subs = append(a.subs, sub)
 
-	if a.client != nil {
-		a.ctx, a.cancel = context.WithCancel(context.Background())
-		if err := a.discoverCameras(); err != nil {
-			log.Printf("plugin-frigate: camera discovery error: %v", err)
-		}
-		go a.reconcileCameras(a.ctx)
-
-		// Initialize MQTT if configured
-		if a.config.MQTT.Host != "" {
-			opts := mqtt.NewClientOptions()
-			brokerURL := fmt.Sprintf("tcp://%s:%s", a.config.MQTT.Host, a.config.MQTT.Port)
-			if a.config.MQTT.Port == "" {
-				brokerURL = fmt.Sprintf("tcp://%s:1883", a.config.MQTT.Host)
-			}
-			opts.AddBroker(brokerURL)
-			if a.config.MQTT.User != "" {
-				opts.SetUsername(a.config.MQTT.User)
-			}
-			if a.config.MQTT.Password != "" {
-				opts.SetPassword(a.config.MQTT.Password)
-			}
-			opts.SetClientID(PluginID + "-" + fmt.Sprintf("%d", time.Now().UnixNano()))
-
-			a.mqttClient = mqtt.NewClient(opts)
-			if token := a.mqttClient.Connect(); token.Wait() && token.Error() != nil {
-				log.Printf("plugin-frigate: failed to connect to MQTT: %v", token.Error())
-			} else {
-				topic := a.config.MQTT.TopicPrefix + "/events"
-				if token := a.mqttClient.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
-					if err := a.HandleMQTTEvent(msg.Payload()); err != nil {
-						log.Printf("plugin-frigate: mqtt handle error: %v", err)
-					}
-				}); token.Wait() && token.Error() != nil {
-					log.Printf("plugin-frigate: failed to subscribe to MQTT topic %s: %v", topic, token.Error())
-				} else {
-					log.Printf("plugin-frigate: listening for real-time events on MQTT topic: %s", topic)
-				}
-			}
-		}
+	a.syncPluginDevice()
+	a.removeOrphans()
+	for _, inst := range a.instances {
+		inst.startInstance()
 	}
+	a.watchOrphans()
+
+	a.watchConfig()
 
 	log.Println("plugin-frigate: started")
 	return nil, nil
 }
 
-func (a *App) OnShutdown() error {
-	if a.cancel != nil {
-		a.cancel()
+// initInstance creates the Frigate and go2rtc clients and the archive of
+// one instance.
+func (a *App) initInstance() {
+	if a.config.URL == "" {
+		return
+	}
+	timeout := a.config.Timeout
+	if timeout == 0 {
+		timeout = 30000
+	}
+	a.client = NewFrigateClient(
+		a.config.URL,
+		a.config.Username,
+		a.config.Password,
+		time.Duration(timeout)*time.Millisecond,
+	)
+	a.go2rtc = a.newGo2RTCClient(time.Duration(timeout) * time.Millisecond)
+
+	if a.config.Archive.Dir != "" && len(a.config.Archive.Rules) > 0 {
+		a.archive = newArchiver(a.config.Archive)
+		a.loadArchiveIndex()
+	}
+
+	if a.config.MQTT.TopicPrefix == "" {
+		a.config.MQTT.TopicPrefix = defaultMQTTTopic
+	}
+
+	a.mu.Lock()
+	a.exportsUnsupported = false
+	a.mu.Unlock()
+}
+
+// startInstance runs discovery and starts the reconcile, stream health and
+// MQTT loops of one instance.
+func (a *App) startInstance() {
+	if a.client == nil {
+		return
+	}
+
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.restoreRuntime(a.ctx)
+	if _, err := a.discoverCameras(); err != nil {
+		log.Printf("plugin-frigate: %scamera discovery error: %v", a.logPrefix(), err)
+	}
+	a.loops.Add(4)
+	go func() {
+		defer a.loops.Done()
+		a.reconcileCameras(a.ctx)
+	}()
+	go func() {
+		defer a.loops.Done()
+		a.reapStaleEvents(a.ctx)
+	}()
+	go func() {
+		defer a.loops.Done()
+		a.watchRuntime(a.ctx)
+	}()
+	go func() {
+		defer a.loops.Done()
+		a.monitorStreams(a.ctx)
+	}()
+
+	if a.mqttClient == nil {
+		a.connectMQTT()
+	}
+}
+
+// connectMQTT subscribes to Frigate's event topic when MQTT is configured.
+func (a *App) connectMQTT() {
+	if a.config.MQTT.Host == "" {
+		return
+	}
+	opts := mqtt.NewClientOptions()
+	brokerURL := fmt.Sprintf("tcp://%s:%s", a.config.MQTT.Host, a.config.MQTT.Port)
+	if a.config.MQTT.Port == "" {
+		brokerURL = fmt.Sprintf("tcp://%s:1883", a.config.MQTT.Host)
+	}
+	opts.AddBroker(brokerURL)
+	if a.config.MQTT.User != "" {
+		opts.SetUsername(a.config.MQTT.User)
+	}
+	if a.config.MQTT.Password != "" {
+		opts.SetPassword(a.config.MQTT.Password)
+	}
+	opts.SetClientID(PluginID + "-" + fmt.Sprintf("%d", time.Now().UnixNano()))
+
+	a.mqttClient = mqtt.NewClient(opts)
+	if token := a.mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		log.Printf("plugin-frigate: %sfailed to connect to MQTT: %v", a.logPrefix(), token.Error())
+	} else {
+		topic := a.config.MQTT.TopicPrefix + "/events"
+		if token := a.mqttClient.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			if err := a.HandleMQTTEvent(msg.Payload()); err != nil {
+				log.Printf("plugin-frigate: mqtt handle error: %v", err)
+			}
+		}); token.Wait() && token.Error() != nil {
+			log.Printf("plugin-frigate: failed to subscribe to MQTT topic %s: %v", topic, token.Error())
+		} else {
+			log.Printf("plugin-frigate: %slistening for real-time events on MQTT topic: %s", a.logPrefix(), topic)
+		}
 	}
+}
+
+// stopInstance stops the loops of one instance and stores its runtime once
+// they have returned, so no loop writes after the final flush.
+func (a *App) stopInstance() {
+	a.stopLoops()
+	a.disconnectMQTT()
+	a.flushRuntime()
+}
+
+func (a *App) disconnectMQTT() {
 	if a.mqttClient != nil && a.mqttClient.IsConnected() {
 		a.mqttClient.Disconnect(250)
 	}
+	a.mqttClient = nil
+}
+
+func (a *App) OnShutdown() error {
+	a.stopWatching()
+	a.stopLoops()
+	for _, inst := range a.instances {
+		inst.stopInstance()
+	}
+	if a.media != nil {
+		a.media.stop()
+	}
 	for _, sub := range a.subs {
 		sub.Unsubscribe()
 	}
@@ -472,77 +775,66 @@ func (a *App) OnShutdown() error {
 	return nil
 }
 
-func (a *App) loadConfig() error {
-	configJSON := os.Getenv("FRIGATE_CONFIG")
-	if configJSON != "" {
-		return json.Unmarshal([]byte(configJSON), &a.config)
-	}
-
-	if _, err := os.Stat("config.json"); err == nil {
-		data, err := os.ReadFile("config.json")
-		if err != nil {
-			return err
-		}
-		return json.Unmarshal(data, &a.config)
-	}
-
-	url := os.Getenv("FRIGATE_URL")
-	if url != "" {
-		a.config.URL = url
-		a.config.Go2RTCURL = os.Getenv("FRIGATE_GO2RTC_URL")
-		a.config.Username = os.Getenv("FRIGATE_USERNAME")
-		a.config.Password = os.Getenv("FRIGATE_PASSWORD")
-		timeout := 30000
-		if t := os.Getenv("FRIGATE_TIMEOUT_MS"); t != "" {
-			if ti, err := strconv.Atoi(t); err == nil {
-				timeout = ti
-			}
-		}
-		a.config.Timeout = timeout
-	}
-	a.config.MQTT.Host = os.Getenv("FRIGATE_MQTT_HOST")
-	a.config.MQTT.Port = os.Getenv("FRIGATE_MQTT_PORT")
-	a.config.MQTT.User = os.Getenv("FRIGATE_MQTT_USER")
-	a.config.MQTT.Password = os.Getenv("FRIGATE_MQTT_PASSWORD")
-	a.config.MQTT.TopicPrefix = os.Getenv("FRIGATE_MQTT_TOPIC_PREFIX")
-	if a.config.MQTT.TopicPrefix == "" {
-		a.config.MQTT.TopicPrefix = "frigate"
+// loadConfig reads the startup config. Problems are reported through the
+// diagnostics entity; the plugin still starts with whatever was readable.
+func (a *App) loadConfig() {
+	config, err := readConfig()
+	if err != nil {
+		a.setDiagnostics(config.source, []string{err.Error()}, false)
+		return
 	}
-
-	return nil
+	a.config = config
+	a.source = config
+	setSecrets(config.secretValues())
+	a.setDiagnostics(config.source, config.problems(), false)
 }
 
-func (a *App) discoverCameras() error {
+// discoverCameras reconciles storage with Frigate's config and reports what
+// changed. Periodic and on-demand reconciles are serialized.
+func (a *App) discoverCameras() (ReconcileDiff, error) {
+	a.reconcileMu.Lock()
+	defer a.reconcileMu.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	cameras, err := a.client.GetConfig(ctx)
+	config, err := a.client.GetServerConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("get config: %w", err)
+		return ReconcileDiff{}, fmt.Errorf("get config: %w", err)
 	}
-	return a.syncCameraConfig(cameras)
-}
-
-func (a *App) reconcileCameras(ctx context.Context) {
-	ticker := a.newTicker(ReconcileInterval)
-	defer ticker.Stop()
+	cameras := config.Cameras
+	a.mu.Lock()
+	a.cameras = cameras
+	a.unitSystem = config.UI.UnitSystem
+	a.mu.Unlock()
+	a.refreshStreamCatalog(ctx, config.StreamNames())
+	diff, err := a.syncCameraConfig(cameras)
+	if err != nil {
+		return diff, err
+	}
+	a.enforceArchiveRetention()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := a.discoverCameras(); err != nil {
-				log.Printf("plugin-frigate: camera reconcile error: %v", err)
-			}
+	if err := a.refreshExports(ctx); err != nil {
+		log.Printf("plugin-frigate: export refresh error: %v", err)
+		return diff, nil
+	}
+	for name := range cameras {
+		if a.config.Cameras.includes(name) {
+			a.updateExports(name, func(*ExportsState) {})
 		}
 	}
+	return diff, nil
 }
 
-func (a *App) handleCommand(addr messenger.Address, cmd any) {
-	cameraID := addr.DeviceID
+func (a *App) handleCommand(addr messenger.Address, cmd any, msg *messenger.Message) {
+	cameraID := a.cameraForDevice(addr.DeviceID)
+	if !a.entityAllowed(domain.Entity{Plugin: PluginID, DeviceID: addr.DeviceID, ID: addr.EntityID}) {
+		log.Printf("plugin-frigate: rejecting %T for %s: excluded by the camera filters or profile", cmd, addr.Key())
+		reply(msg, rejectedCommand{Camera: cameraID, Error: fmt.Sprintf("%s is not enabled for camera %s", addr.EntityID, cameraID)})
+		return
+	}
 
-	switch cmd.(type) {
+	switch c := cmd.(type) {
 	case CameraEnableDetect:
 		a.handleEnableDetect(cameraID, true)
 	case CameraDisableDetect:
@@ -555,6 +847,18 @@ func (a *App) handleCommand(addr messenger.Address, cmd any) {
 		a.handleEnableSnapshots(cameraID, true)
 	case CameraDisableSnapshots:
 		a.handleEnableSnapshots(cameraID, false)
+	case CameraCreateEvent:
+		a.handleCreateEvent(cameraID, c, msg)
+	case CameraEndEvent:
+		a.handleEndEvent(cameraID, c, msg)
+	case CameraExport:
+		a.handleExport(cameraID, c, msg)
+	case CameraWebRTCOffer:
+		a.handleWebRTCOffer(cameraID, addr.EntityID, c, msg)
+	case CameraStreamURL:
+		a.handleStreamURL(cameraID, addr.EntityID, msg)
+	case CameraTalkback:
+		a.handleTalkback(cameraID, addr.EntityID, c, msg)
 	default:
 		log.Printf("plugin-frigate: unknown command %T for %s", cmd, addr.Key())
 	}
@@ -566,9 +870,9 @@ func (a *App) handleEnableDetect(cameraID string, enabled bool) {
 
 	if err := a.client.SetDetect(ctx, cameraID, enabled); err != nil {
 		log.Printf("plugin-frigate: failed to set detect for %s: %v", cameraID, err)
-		a.setRuntimeLastError(cameraID, err.Error())
+		a.setRuntimeLastError(cameraID, redactError(err))
 		a.updateCameraState(cameraID, func(s *CameraState) {
-			s.LastError = err.Error()
+			s.LastError = redactError(err)
 		})
 		return
 	}
@@ -590,9 +894,9 @@ func (a *App) handleEnableRecord(cameraID string, enabled bool) {
 
 	if err := a.client.SetRecord(ctx, cameraID, enabled); err != nil {
 		log.Printf("plugin-frigate: failed to set record for %s: %v", cameraID, err)
-		a.setRuntimeLastError(cameraID, err.Error())
+		a.setRuntimeLastError(cameraID, redactError(err))
 		a.updateCameraState(cameraID, func(s *CameraState) {
-			s.LastError = err.Error()
+			s.LastError = redactError(err)
 		})
 		return
 	}
@@ -614,9 +918,9 @@ func (a *App) handleEnableSnapshots(cameraID string, enabled bool) {
 
 	if err := a.client.SetSnapshots(ctx, cameraID, enabled); err != nil {
 		log.Printf("plugin-frigate: failed to set snapshots for %s: %v", cameraID, err)
-		a.setRuntimeLastError(cameraID, err.Error())
+		a.setRuntimeLastError(cameraID, redactError(err))
 		a.updateCameraState(cameraID, func(s *CameraState) {
-			s.LastError = err.Error()
+			s.LastError = redactError(err)
 		})
 		return
 	}
@@ -633,7 +937,7 @@ func (a *App) handleEnableSnapshots(cameraID string, enabled bool) {
 }
 
 func (a *App) updateCameraState(cameraID string, update func(*CameraState)) {
-	eKey := domain.EntityKey{Plugin: PluginID, DeviceID: cameraID, ID: "camera-state"}
+	eKey := domain.EntityKey{Plugin: PluginID, DeviceID: a.deviceID(cameraID), ID: "camera-state"}
 	raw, err := a.store.Get(eKey)
 	if err != nil {
 		log.Printf("plugin-frigate: failed to get camera %s: %v", cameraID, err)
@@ -656,7 +960,7 @@ func (a *App) updateCameraState(cameraID string, update func(*CameraState)) {
 }
 
 func (a *App) updateStatusEntity(cameraID, entityID, value string) {
-	eKey := domain.EntityKey{Plugin: PluginID, DeviceID: cameraID, ID: entityID}
+	eKey := domain.EntityKey{Plugin: PluginID, DeviceID: a.deviceID(cameraID), ID: entityID}
 	raw, err := a.store.Get(eKey)
 	if err != nil {
 		log.Printf("plugin-frigate: failed to get status %s for %s: %v", entityID, cameraID, err)
@@ -681,6 +985,12 @@ func (a *App) updateStatusEntity(cameraID, entityID, value string) {
 func (a *App) setRuntimeLastError(cameraID, message string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	a.cameraRuntimeLocked(cameraID).LastError = message
+}
+
+// cameraRuntimeLocked returns the live runtime for cameraID, creating it if
+// needed. The caller must hold a.mu.
+func (a *App) cameraRuntimeLocked(cameraID string) *cameraRuntime {
 	if a.runtime == nil {
 		a.runtime = make(map[string]*cameraRuntime)
 	}
@@ -692,7 +1002,7 @@ func (a *App) setRuntimeLastError(cameraID, message string) {
 		}
 		a.runtime[cameraID] = runtime
 	}
-	runtime.LastError = message
+	return runtime
 }
 
 func ConvertToCameraState(v any) CameraState {
@@ -762,19 +1072,21 @@ func (a *App) cameraState(config CameraConfig, runtime *cameraRuntime) CameraSta
 }
 
 func (a *App) childEntities(camera string, config CameraConfig, runtime *cameraRuntime) []domain.Entity {
+	cameraState := a.cameraState(config, runtime)
+	cameraState.Area = a.config.Cameras.Overrides[camera].Area
 	entities := []domain.Entity{
 		{
 			ID:       "camera-state",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_camera_status",
 			Name:     "Camera State",
-			State:    a.cameraState(config, runtime),
+			State:    cameraState,
 		},
 		{
 			ID:       "availability",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_availability",
 			Name:     "Availability",
 			State:    AvailabilityState{Available: true},
@@ -782,42 +1094,44 @@ func (a *App) childEntities(camera string, config CameraConfig, runtime *cameraR
 		{
 			ID:       "image-latest",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_image",
 			Name:     "Latest Snapshot",
 			State: ImageState{
-				URL:    a.apiURL(fmt.Sprintf("/api/%s/latest.jpg", camera)),
+				URL:    a.imageURL(camera, "latest.jpg", ""),
 				Format: "jpeg",
 				Online: true,
 			},
 		},
 	}
 
-	for _, spec := range streamSpecs() {
-		entities = append(entities, domain.Entity{
-			ID:       spec.ID,
-			Plugin:   PluginID,
-			DeviceID: camera,
-			Type:     "frigate_stream",
-			Name:     spec.Name,
-			State: StreamState{
-				URL:    a.go2rtcURL(spec.Path, camera),
-				Format: spec.Format,
-				Kind:   spec.Kind,
-				Online: true,
-			},
-		})
-	}
+	entities = append(entities, a.streamEntities(camera)...)
+	entities = append(entities, a.streamStatusEntity(camera))
 
 	entities = append(entities, a.eventEntities(camera, runtime)...)
+	entities = append(entities, a.eventMediaEntities(camera, runtime)...)
 	entities = append(entities, a.summaryEntities(camera, runtime)...)
+	entities = append(entities, a.groupEntities(camera, runtime)...)
+	entities = append(entities, a.counterEntities(camera, runtime)...)
+	entities = append(entities, a.objectEntities(camera, runtime)...)
+	entities = append(entities, a.loiteringEntities(camera, config.Zones, runtime)...)
+	entities = append(entities, a.speedEntities(camera, config.Zones, runtime)...)
+	entities = append(entities, a.reapedEntity(camera, runtime))
 	entities = append(entities, a.configEntities(camera, config)...)
 	entities = append(entities, a.commandEntities(camera)...)
+	entities = append(entities,
+		manualEventEntity(a.deviceID(camera), runtime.Manual),
+		exportsEntity(a.deviceID(camera), runtime.Exports),
+		exportButtonEntity(a.deviceID(camera)),
+	)
+	if a.archive != nil {
+		entities = append(entities, a.archiveCountEntity(camera))
+	}
 	return entities
 }
 
 func (a *App) eventEntities(camera string, runtime *cameraRuntime) []domain.Entity {
-	labels := runtimeLabels(runtime)
+	labels := a.runtimeLabels(runtime)
 	entities := make([]domain.Entity, 0, len(labels))
 	for _, label := range labels {
 		item := runtime.label(label)
@@ -841,7 +1155,7 @@ func (a *App) eventEntities(camera string, runtime *cameraRuntime) []domain.Enti
 		entities = append(entities, domain.Entity{
 			ID:       "event-" + sanitizeID(label),
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_event_sensor",
 			Name:     strings.Title(label) + " Events",
 			State:    state,
@@ -853,23 +1167,22 @@ func (a *App) eventEntities(camera string, runtime *cameraRuntime) []domain.Enti
 func (a *App) summaryEntities(camera string, runtime *cameraRuntime) []domain.Entity {
 	allCount := 0
 	allActive := 0
+	occupied := false
 	if runtime != nil {
-		for _, label := range runtimeLabels(runtime) {
+		for _, label := range a.runtimeLabels(runtime) {
 			item := runtime.label(label)
 			allCount += item.Count
 			allActive += len(item.Active)
+			occupied = occupied || item.Occupied
 		}
 	}
-	occupancy := "Clear"
-	if allActive > 0 {
-		occupancy = "Detected"
-	}
+	occupancy := occupancyLabel(occupied)
 
 	return []domain.Entity{
 		{
 			ID:       "status-all-count",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "All Count",
 			State: StatusSensorState{
@@ -881,7 +1194,7 @@ func (a *App) summaryEntities(camera string, runtime *cameraRuntime) []domain.En
 		{
 			ID:       "status-all-active-count",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "All Active Count",
 			State: StatusSensorState{
@@ -893,7 +1206,7 @@ func (a *App) summaryEntities(camera string, runtime *cameraRuntime) []domain.En
 		{
 			ID:       "status-all-occupancy",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "All Occupancy",
 			State: StatusSensorState{
@@ -910,7 +1223,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-detect",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Detect",
 			State:    StatusSensorState{Value: onOff(config.Detect.Enabled), Available: true},
@@ -918,7 +1231,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-motion",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Motion",
 			State:    StatusSensorState{Value: onOff(config.Motion.Enabled), Available: true},
@@ -926,7 +1239,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-record",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Record",
 			State:    StatusSensorState{Value: onOff(config.Record.Enabled), Available: true},
@@ -934,7 +1247,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-snapshots",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Snapshots",
 			State:    StatusSensorState{Value: onOff(config.Snap.Enabled), Available: true},
@@ -942,7 +1255,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-review-alerts",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Review Alerts",
 			State:    StatusSensorState{Value: onOff(config.Review.Alerts.Enabled), Available: true},
@@ -950,7 +1263,7 @@ func (a *App) configEntities(camera string, config CameraConfig) []domain.Entity
 		{
 			ID:       "status-review-detections",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "frigate_status_sensor",
 			Name:     "Review Detections",
 			State:    StatusSensorState{Value: onOff(config.Review.Detections.Enabled), Available: true},
@@ -963,7 +1276,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "detect-enable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Enable Detect",
 			Commands: []string{"frigate_camera_enable_detect"},
@@ -972,7 +1285,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "detect-disable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Disable Detect",
 			Commands: []string{"frigate_camera_disable_detect"},
@@ -981,7 +1294,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "record-enable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Enable Record",
 			Commands: []string{"frigate_camera_enable_record"},
@@ -990,7 +1303,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "record-disable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Disable Record",
 			Commands: []string{"frigate_camera_disable_record"},
@@ -999,7 +1312,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "snapshots-enable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Enable Snapshots",
 			Commands: []string{"frigate_camera_enable_snapshots"},
@@ -1008,7 +1321,7 @@ func (a *App) commandEntities(camera string) []domain.Entity {
 		{
 			ID:       "snapshots-disable",
 			Plugin:   PluginID,
-			DeviceID: camera,
+			DeviceID: a.deviceID(camera),
 			Type:     "button",
 			Name:     "Disable Snapshots",
 			Commands: []string{"frigate_camera_disable_snapshots"},
@@ -1032,19 +1345,7 @@ func configuredLabels(config CameraConfig) []string {
 		labels = append(labels, label)
 	}
 	if len(labels) == 0 {
-		labels = []string{"car", "person"}
-	}
-	sort.Strings(labels)
-	return labels
-}
-
-func runtimeLabels(runtime *cameraRuntime) []string {
-	if runtime == nil || len(runtime.Labels) == 0 {
-		return []string{"car", "person"}
-	}
-	labels := make([]string, 0, len(runtime.Labels))
-	for label := range runtime.Labels {
-		labels = append(labels, label)
+		labels = append(labels, defaultLabels...)
 	}
 	sort.Strings(labels)
 	return labels
@@ -1063,7 +1364,11 @@ func (r *cameraRuntime) label(label string) *labelRuntime {
 	if existing, ok := r.ByLabel[label]; ok {
 		return existing
 	}
-	state := &labelRuntime{Active: make(map[string]Event)}
+	state := &labelRuntime{
+		Active:  make(map[string]Event),
+		Seen:    make(map[string]time.Time),
+		Windows: make(windowCounter),
+	}
 	r.ByLabel[label] = state
 	return state
 }
@@ -1082,9 +1387,12 @@ func (a *App) ensureCameraRuntime(camera string, config CameraConfig) *cameraRun
 		}
 		a.runtime[camera] = state
 	}
-	for _, label := range configuredLabels(config) {
+	for _, label := range a.config.Labels.canonicalAll(configuredLabels(config)) {
 		state.label(label)
 	}
+	for zone := range config.Zones {
+		state.zone(zone)
+	}
 	return cloneRuntime(state)
 }
 
@@ -1093,14 +1401,14 @@ func (a *App) runtimeSnapshot(camera string) *cameraRuntime {
 	defer a.mu.Unlock()
 	if a.runtime == nil {
 		return &cameraRuntime{
-			Labels:  map[string]struct{}{"car": {}, "person": {}},
+			Labels:  map[string]struct{}{},
 			ByLabel: map[string]*labelRuntime{},
 		}
 	}
 	state, ok := a.runtime[camera]
 	if !ok {
 		return &cameraRuntime{
-			Labels:  map[string]struct{}{"car": {}, "person": {}},
+			Labels:  map[string]struct{}{},
 			ByLabel: map[string]*labelRuntime{},
 		}
 	}
@@ -1129,6 +1437,7 @@ func (a *App) saveEntityIfChanged(entity domain.Entity) (bool, error) {
 	}
 	return true, nil
 }
+
 func (a *App) saveDeviceIfChanged(device domain.Device) (bool, error) {
 	body, err := json.Marshal(device)
 	if err != nil {
@@ -1150,18 +1459,25 @@ func (a *App) deleteStorageKey(key string) error {
 
 func (a *App) desiredEntities(camera string, config CameraConfig) []domain.Entity {
 	runtime := a.ensureCameraRuntime(camera, config)
-	return a.childEntities(camera, config, runtime)
+	return a.allowedEntities(a.childEntities(camera, config, runtime))
 }
 
+// desiredDevice applies the camera's name override. The area override is
+// reported on camera-state, since device labels belong to the user.
 func (a *App) desiredDevice(camera string) domain.Device {
-	return domain.Device{
-		ID:     camera,
+	device := domain.Device{
+		ID:     a.deviceID(camera),
 		Plugin: PluginID,
 		Name:   camera,
 	}
+	if name := a.config.Cameras.Overrides[camera].Name; name != "" {
+		device.Name = name
+	}
+	return device
 }
 
-func (a *App) syncCameraConfig(cameras map[string]CameraConfig) error {
+func (a *App) syncCameraConfig(cameras map[string]CameraConfig) (ReconcileDiff, error) {
+	var diff ReconcileDiff
 	desiredDevices := make(map[string]domain.Device)
 	desiredEntities := make(map[string]domain.Entity)
 
@@ -1171,8 +1487,15 @@ func (a *App) syncCameraConfig(cameras map[string]CameraConfig) error {
 	}
 	sort.Strings(cameraNames)
 
+	// Cameras the filters drop are removed at once rather than after the
+	// deletion grace period, which only guards against Frigate hiccups.
+	filtered := make(map[string]struct{})
 	for _, name := range cameraNames {
 		config := cameras[name]
+		if !a.config.Cameras.includes(name) {
+			filtered[a.deviceID(name)] = struct{}{}
+			continue
+		}
 		device := a.desiredDevice(name)
 		desiredDevices[device.Key()] = device
 		for _, entity := range a.desiredEntities(name, config) {
@@ -1182,14 +1505,31 @@ func (a *App) syncCameraConfig(cameras map[string]CameraConfig) error {
 
 	existing, err := a.store.Search(PluginID + ".>")
 	if err != nil {
-		return fmt.Errorf("search existing frigate records: %w", err)
+		return diff, fmt.Errorf("search existing frigate records: %w", err)
+	}
+	existingKeys := make(map[string]struct{}, len(existing))
+	storedIDs := make(map[string]struct{})
+	for _, entry := range existing {
+		existingKeys[entry.Key] = struct{}{}
+		device, entity, _ := strings.Cut(strings.TrimPrefix(entry.Key, PluginID+"."), ".")
+		if entity == "" && a.ownsDevice(device) {
+			storedIDs[device] = struct{}{}
+		}
 	}
+	changedDevices := make(map[string]struct{})
 
 	// Parents before children: save devices, then entities.
 	for _, key := range sortedDeviceKeys(desiredDevices) {
 		device := desiredDevices[key]
-		if _, err := a.saveDeviceIfChanged(device); err != nil {
+		changed, err := a.saveDeviceIfChanged(device)
+		if err != nil {
 			log.Printf("plugin-frigate: failed to save device %s: %v", key, err)
+			continue
+		}
+		if _, ok := storedIDs[device.ID]; !ok {
+			diff.CamerasAdded = append(diff.CamerasAdded, device.ID)
+		} else if changed {
+			changedDevices[device.ID] = struct{}{}
 		}
 	}
 	for _, key := range sortedEntityKeys(desiredEntities) {
@@ -1199,6 +1539,15 @@ func (a *App) syncCameraConfig(cameras map[string]CameraConfig) error {
 			log.Printf("plugin-frigate: failed to save entity %s: %v", key, err)
 			continue
 		}
+		if changed {
+			name := strings.TrimPrefix(key, PluginID+".")
+			if _, ok := existingKeys[key]; ok {
+				diff.EntitiesChanged = append(diff.EntitiesChanged, name)
+			} else {
+				diff.EntitiesAdded = append(diff.EntitiesAdded, name)
+			}
+			changedDevices[entity.DeviceID] = struct{}{}
+		}
 		if changed && entity.ID == "camera-state" {
 			state := entity.State.(CameraState)
 			log.Printf("plugin-frigate: synced camera %s (enabled=%v, detect=%v)",
@@ -1206,18 +1555,59 @@ func (a *App) syncCameraConfig(cameras map[string]CameraConfig) error {
 		}
 	}
 
+	desiredIDs := make(map[string]struct{}, len(desiredDevices))
+	for _, device := range desiredDevices {
+		desiredIDs[device.ID] = struct{}{}
+	}
+	candidates := make(map[string]struct{}, len(storedIDs))
+	for device := range storedIDs {
+		if _, ok := filtered[device]; !ok {
+			candidates[device] = struct{}{}
+		}
+	}
+	due := a.staleDevices(candidates, desiredIDs)
+	for device := range filtered {
+		due[device] = struct{}{}
+	}
+
 	for _, entry := range existing {
+		if !a.ownsKey(entry.Key) {
+			continue
+		}
 		if _, ok := desiredDevices[entry.Key]; ok {
 			continue
 		}
 		if _, ok := desiredEntities[entry.Key]; ok {
 			continue
 		}
+		name := strings.TrimPrefix(entry.Key, PluginID+".")
+		device, entity, _ := strings.Cut(name, ".")
+		_, stored := storedIDs[device]
+		_, desired := desiredIDs[device]
+		if _, ok := due[device]; stored && !desired && !ok {
+			continue
+		}
 		if err := a.deleteStorageKey(entry.Key); err != nil {
 			log.Printf("plugin-frigate: failed to delete stale record %s: %v", entry.Key, err)
+			continue
+		}
+		if entity == "" {
+			a.forgetRuntime(device)
+			diff.CamerasRemoved = append(diff.CamerasRemoved, device)
+			continue
+		}
+		diff.EntitiesRemoved = append(diff.EntitiesRemoved, name)
+		if desired {
+			changedDevices[device] = struct{}{}
 		}
 	}
-	return nil
+	for device := range changedDevices {
+		if _, ok := storedIDs[device]; ok {
+			diff.CamerasChanged = append(diff.CamerasChanged, device)
+		}
+	}
+	diff.sort()
+	return diff, nil
 }
 
 func sortedEntityKeys(m map[string]domain.Entity) []string {
@@ -1249,7 +1639,35 @@ func cloneRuntime(src *cameraRuntime) *cameraRuntime {
 	dst := &cameraRuntime{
 		Labels:    make(map[string]struct{}, len(src.Labels)),
 		ByLabel:   make(map[string]*labelRuntime, len(src.ByLabel)),
+		Reaped:    src.Reaped,
 		LastError: src.LastError,
+		Manual:    src.Manual,
+		Exports:   src.Exports,
+	}
+	if src.Zones != nil {
+		dst.Zones = make(map[string]windowCounter, len(src.Zones))
+		for zone, counts := range src.Zones {
+			dst.Zones[zone] = counts.clone()
+		}
+	}
+	if src.Speeds != nil {
+		dst.Speeds = make(map[string]*zoneSpeed, len(src.Speeds))
+		for zone, speed := range src.Speeds {
+			s := *speed
+			s.Speeding = maps.Clone(speed.Speeding)
+			dst.Speeds[zone] = &s
+		}
+	}
+	if src.Loiter != nil {
+		dst.Loiter = make(map[string]map[string]*loiterEntry, len(src.Loiter))
+		for zone, entries := range src.Loiter {
+			copied := make(map[string]*loiterEntry, len(entries))
+			for id, entry := range entries {
+				e := *entry
+				copied[id] = &e
+			}
+			dst.Loiter[zone] = copied
+		}
 	}
 	if src.LastEvent != nil {
 		e := *src.LastEvent
@@ -1260,8 +1678,12 @@ func cloneRuntime(src *cameraRuntime) *cameraRuntime {
 	}
 	for label, item := range src.ByLabel {
 		copied := &labelRuntime{
-			Count:  item.Count,
-			Active: make(map[string]Event, len(item.Active)),
+			Count:    item.Count,
+			Active:   make(map[string]Event, len(item.Active)),
+			Seen:     make(map[string]time.Time, len(item.Seen)),
+			Windows:  item.Windows.clone(),
+			Occupied: item.Occupied,
+			Pending:  item.Pending,
 		}
 		if item.LastEvent != nil {
 			e := *item.LastEvent
@@ -1270,20 +1692,14 @@ func cloneRuntime(src *cameraRuntime) *cameraRuntime {
 		for id, event := range item.Active {
 			copied.Active[id] = event
 		}
+		for id, seen := range item.Seen {
+			copied.Seen[id] = seen
+		}
 		dst.ByLabel[label] = copied
 	}
 	return dst
 }
 
-func streamSpecs() []streamSpec {
-	return []streamSpec{
-		{ID: "stream-main", Name: "Main Stream", Path: "/stream.html?src=%s", Format: "html", Kind: "main"},
-		{ID: "stream-mp4", Name: "MP4 Stream", Path: "/api/stream.mp4?src=%s", Format: "mp4", Kind: "video"},
-		{ID: "stream-hls", Name: "HLS Stream", Path: "/api/stream.m3u8?src=%s", Format: "hls", Kind: "video"},
-		{ID: "stream-mjpeg", Name: "MJPEG Stream", Path: "/api/stream.mjpeg?src=%s", Format: "mjpeg", Kind: "video"},
-	}
-}
-
 func (a *App) go2rtcURL(pathFmt, camera string) string {
 	base := strings.TrimRight(a.config.Go2RTCURL, "/")
 	if base == "" {
@@ -0,0 +1,375 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+	storage "github.com/slidebolt/sb-storage-sdk"
+)
+
+// ArchiveConfig keeps snapshots (and optionally clips) of matching events
+// on the SlideBolt host, independent of Frigate's own retention.
+type ArchiveConfig struct {
+	Dir           string        `json:"dir,omitempty"`
+	MaxAgeSeconds int           `json:"max_age_seconds,omitempty"`
+	MaxBytes      int64         `json:"max_bytes,omitempty"`
+	Rules         []ArchiveRule `json:"rules,omitempty"`
+}
+
+// ArchiveRule selects events to archive. Empty lists match everything;
+// After/Before ("HH:MM", local time) bound the event start time and may
+// wrap midnight, e.g. after 22:00 and before 06:00.
+type ArchiveRule struct {
+	Name        string   `json:"name,omitempty"`
+	Cameras     []string `json:"cameras,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Zones       []string `json:"zones,omitempty"`
+	SubLabels   []string `json:"sub_labels,omitempty"`
+	MinScore    float64  `json:"min_score,omitempty"`
+	After       string   `json:"after,omitempty"`
+	Before      string   `json:"before,omitempty"`
+	IncludeClip bool     `json:"include_clip,omitempty"`
+}
+
+func (r ArchiveRule) matches(event Event) bool {
+	if !matchesAny(r.Cameras, event.Camera) || !matchesAny(r.Labels, event.Label) {
+		return false
+	}
+	if len(r.Zones) > 0 && !anyMatch(r.Zones, event.allZones()) {
+		return false
+	}
+	if len(r.SubLabels) > 0 && !anyMatch(r.SubLabels, []string{string(event.SubLabel), event.RecognizedLicensePlate}) {
+		return false
+	}
+	if r.MinScore > 0 && event.bestScore() < r.MinScore {
+		return false
+	}
+	if r.After != "" || r.Before != "" {
+		start := time.Unix(int64(event.StartTime), 0).Local()
+		if !inTimeWindow(start, r.After, r.Before) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, value string) bool {
+	return len(patterns) == 0 || anyMatch(patterns, []string{value})
+}
+
+func anyMatch(patterns, values []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if value != "" && strings.EqualFold(pattern, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inTimeWindow reports whether t's clock time falls in [after, before).
+// Unparseable bounds are treated as open.
+func inTimeWindow(t time.Time, after, before string) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	from, hasFrom := parseClock(after)
+	to, hasTo := parseClock(before)
+	switch {
+	case hasFrom && hasTo && from > to:
+		return minutes >= from || minutes < to
+	case hasFrom && hasTo:
+		return minutes >= from && minutes < to
+	case hasFrom:
+		return minutes >= from
+	case hasTo:
+		return minutes < to
+	}
+	return true
+}
+
+func parseClock(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// ArchiveRecord is the storage index entry for one archived event.
+type ArchiveRecord struct {
+	EventID    string  `json:"event_id"`
+	Camera     string  `json:"camera"`
+	Label      string  `json:"label"`
+	SubLabel   string  `json:"sub_label,omitempty"`
+	Rule       string  `json:"rule,omitempty"`
+	StartTime  float64 `json:"start_time"`
+	Snapshot   string  `json:"snapshot"`
+	Clip       string  `json:"clip,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	ArchivedAt string  `json:"archived_at"`
+}
+
+func archiveKey(deviceID, eventID string) rawKey {
+	return rawKey(PluginID + ".archive." + deviceID + "." + sanitizeID(eventID))
+}
+
+// archiver owns the on-disk archive and its in-memory copy of the index.
+type archiver struct {
+	config  ArchiveConfig
+	mu      sync.Mutex
+	records map[string]ArchiveRecord
+	pending map[string]struct{}
+}
+
+func newArchiver(config ArchiveConfig) *archiver {
+	return &archiver{
+		config:  config,
+		records: make(map[string]ArchiveRecord),
+		pending: make(map[string]struct{}),
+	}
+}
+
+func (r *archiver) rule(event Event) (ArchiveRule, bool) {
+	for _, rule := range r.config.Rules {
+		if rule.matches(event) {
+			return rule, true
+		}
+	}
+	return ArchiveRule{}, false
+}
+
+func (r *archiver) count(camera string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, record := range r.records {
+		if record.Camera == camera {
+			n++
+		}
+	}
+	return n
+}
+
+// loadArchiveIndex reads the archive index from storage.
+func (a *App) loadArchiveIndex() {
+	entries, err := a.store.SearchFiles(storage.Internal, PluginID+".archive.>")
+	if err != nil {
+		log.Printf("plugin-frigate: failed to load archive index: %v", err)
+		return
+	}
+	a.archive.mu.Lock()
+	defer a.archive.mu.Unlock()
+	for _, entry := range entries {
+		device, _, _ := strings.Cut(strings.TrimPrefix(entry.Key, PluginID+".archive."), ".")
+		if !a.ownsDevice(device) {
+			continue
+		}
+		var record ArchiveRecord
+		if err := json.Unmarshal(entry.Data, &record); err != nil {
+			continue
+		}
+		a.archive.records[entry.Key] = record
+	}
+}
+
+// maybeArchive starts archiving an ended event that matches a rule. The
+// download runs with the instance loops, so stopping them cancels it and
+// waits for it before the archive is replaced.
+func (a *App) maybeArchive(event Event) {
+	archive := a.archive
+	if archive == nil || a.ctx == nil || event.EndTime == 0 || !event.HasSnapshot {
+		return
+	}
+	rule, ok := archive.rule(event)
+	if !ok {
+		return
+	}
+
+	key := archiveKey(a.deviceID(event.Camera), event.ID).Key()
+	archive.mu.Lock()
+	_, done := archive.records[key]
+	_, busy := archive.pending[key]
+	if !done && !busy {
+		archive.pending[key] = struct{}{}
+	}
+	archive.mu.Unlock()
+	if done || busy {
+		return
+	}
+
+	ctx := a.ctx
+	a.loops.Add(1)
+	go func() {
+		defer a.loops.Done()
+		defer func() {
+			archive.mu.Lock()
+			delete(archive.pending, key)
+			archive.mu.Unlock()
+		}()
+		if err := a.archiveEvent(ctx, archive, rule, event); err != nil {
+			log.Printf("plugin-frigate: failed to archive event %s: %v", event.ID, err)
+			return
+		}
+		a.enforceArchiveRetention()
+		a.syncArchiveCount(event.Camera)
+	}()
+}
+
+func (a *App) archiveEvent(ctx context.Context, archive *archiver, rule ArchiveRule, event Event) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	// The camera comes from MQTT and names a directory, so only cameras
+	// Frigate's config lists are archived.
+	a.mu.Lock()
+	_, known := a.cameras[event.Camera]
+	a.mu.Unlock()
+	if !known {
+		return fmt.Errorf("unknown camera %q", event.Camera)
+	}
+
+	dir := filepath.Join(archive.config.Dir, a.deviceID(event.Camera))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create archive dir: %w", err)
+	}
+	base := filepath.Join(dir, sanitizeID(event.ID))
+
+	record := ArchiveRecord{
+		EventID:    event.ID,
+		Camera:     event.Camera,
+		Label:      event.Label,
+		SubLabel:   string(event.SubLabel),
+		Rule:       rule.Name,
+		StartTime:  event.StartTime,
+		ArchivedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	n, err := a.client.DownloadEventMedia(ctx, event.ID, "snapshot.jpg", base+".jpg")
+	if err != nil {
+		return err
+	}
+	record.Snapshot = base + ".jpg"
+	record.Bytes += n
+
+	if rule.IncludeClip && event.HasClip {
+		n, err := a.client.DownloadEventMedia(ctx, event.ID, "clip.mp4", base+".mp4")
+		if err != nil {
+			log.Printf("plugin-frigate: archiving event %s without clip: %v", event.ID, err)
+		} else {
+			record.Clip = base + ".mp4"
+			record.Bytes += n
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal archive record: %w", err)
+	}
+	key := archiveKey(a.deviceID(event.Camera), event.ID)
+	if err := a.store.SetInternal(key, data); err != nil {
+		return fmt.Errorf("index archive record: %w", err)
+	}
+
+	archive.mu.Lock()
+	archive.records[key.Key()] = record
+	archive.mu.Unlock()
+
+	log.Printf("plugin-frigate: archived %s event %s for camera %s (rule %q)", event.Label, event.ID, event.Camera, rule.Name)
+	return nil
+}
+
+// enforceArchiveRetention removes records older than the max age, then the
+// oldest records until the archive fits in max bytes.
+func (a *App) enforceArchiveRetention() {
+	if a.archive == nil {
+		return
+	}
+
+	a.archive.mu.Lock()
+	keys := make([]string, 0, len(a.archive.records))
+	var total int64
+	for key, record := range a.archive.records {
+		keys = append(keys, key)
+		total += record.Bytes
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return a.archive.records[keys[i]].StartTime < a.archive.records[keys[j]].StartTime
+	})
+
+	var expired []string
+	maxAge := time.Duration(a.archive.config.MaxAgeSeconds) * time.Second
+	cutoff := float64(time.Now().Add(-maxAge).Unix())
+	for _, key := range keys {
+		record := a.archive.records[key]
+		tooOld := maxAge > 0 && record.StartTime < cutoff
+		tooBig := a.archive.config.MaxBytes > 0 && total > a.archive.config.MaxBytes
+		if !tooOld && !tooBig {
+			continue
+		}
+		expired = append(expired, key)
+		total -= record.Bytes
+	}
+	removed := make([]ArchiveRecord, 0, len(expired))
+	for _, key := range expired {
+		removed = append(removed, a.archive.records[key])
+		delete(a.archive.records, key)
+	}
+	a.archive.mu.Unlock()
+
+	cameras := make(map[string]struct{})
+	for i, record := range removed {
+		for _, file := range []string{record.Snapshot, record.Clip} {
+			if file == "" {
+				continue
+			}
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				log.Printf("plugin-frigate: failed to remove archived file %s: %v", file, err)
+			}
+		}
+		if err := a.store.DeleteInternal(rawKey(expired[i])); err != nil {
+			log.Printf("plugin-frigate: failed to delete archive record %s: %v", expired[i], err)
+		}
+		cameras[record.Camera] = struct{}{}
+	}
+	for camera := range cameras {
+		a.syncArchiveCount(camera)
+	}
+}
+
+func (a *App) syncArchiveCount(camera string) {
+	entity := a.archiveCountEntity(camera)
+	if !a.entityAllowed(entity) {
+		return
+	}
+	if _, err := a.saveEntityIfChanged(entity); err != nil {
+		log.Printf("plugin-frigate: failed to update archive count for %s: %v", camera, err)
+	}
+}
+
+func (a *App) archiveCountEntity(camera string) domain.Entity {
+	count := a.archive.count(camera)
+	return domain.Entity{
+		ID:       "archive-count",
+		Plugin:   PluginID,
+		DeviceID: a.deviceID(camera),
+		Type:     "frigate_status_sensor",
+		Name:     "Archived Events",
+		State: StatusSensorState{
+			Value:     fmt.Sprintf("%d events", count),
+			Count:     count,
+			Available: true,
+		},
+	}
+}
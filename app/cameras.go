@@ -0,0 +1,153 @@
+package app
+
+import (
+	"path"
+	"strings"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// Entity profiles decide which entity families a camera gets.
+const (
+	ProfileMinimal  = "minimal"
+	ProfileStandard = "standard"
+	ProfileFull     = "full"
+)
+
+// Entity families, see entityFamily.
+const (
+	familyCore       = "core"
+	familyEvents     = "events"
+	familyEventMedia = "event_media"
+	familyStreams    = "streams"
+	familyStatus     = "status"
+	familyControls   = "controls"
+	familyRecordings = "recordings"
+)
+
+var profileFamilies = map[string]map[string]struct{}{
+	ProfileMinimal: {
+		familyCore:   {},
+		familyEvents: {},
+	},
+	ProfileStandard: {
+		familyCore:       {},
+		familyEvents:     {},
+		familyEventMedia: {},
+		familyStreams:    {},
+		familyStatus:     {},
+	},
+}
+
+// CamerasConfig selects which Frigate cameras become devices and how.
+// Include and Exclude are path.Match globs on the Frigate camera name; an
+// empty Include matches every camera and Exclude wins over Include.
+type CamerasConfig struct {
+	Include   []string                  `json:"include,omitempty"`
+	Exclude   []string                  `json:"exclude,omitempty"`
+	Profile   string                    `json:"profile,omitempty"`
+	Overrides map[string]CameraOverride `json:"overrides,omitempty"`
+}
+
+// CameraOverride customises one camera, keyed by its Frigate name.
+type CameraOverride struct {
+	Name    string `json:"name,omitempty"`
+	Area    string `json:"area,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+func (c CamerasConfig) includes(camera string) bool {
+	if len(c.Include) > 0 && !globMatch(c.Include, camera) {
+		return false
+	}
+	return !globMatch(c.Exclude, camera)
+}
+
+func globMatch(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CamerasConfig) profile(camera string) string {
+	if p := c.Overrides[camera].Profile; p != "" {
+		return p
+	}
+	if c.Profile != "" {
+		return c.Profile
+	}
+	return ProfileFull
+}
+
+func validProfile(profile string) bool {
+	switch profile {
+	case "", ProfileMinimal, ProfileStandard, ProfileFull:
+		return true
+	}
+	return false
+}
+
+// entityFamily groups a camera entity ID for profile selection. Per-label
+// and zone sensors fall into events.
+func entityFamily(id string) string {
+	switch {
+	case id == "camera-state" || id == "availability" || id == "image-latest":
+		return familyCore
+	case strings.HasPrefix(id, "stream-") || strings.HasPrefix(id, "restream-"):
+		return familyStreams
+	case strings.HasPrefix(id, "image-") || strings.HasPrefix(id, "clip-"):
+		return familyEventMedia
+	case strings.HasPrefix(id, "status-all-"):
+		return familyEvents
+	case strings.HasPrefix(id, "status-"):
+		return familyStatus
+	case strings.HasSuffix(id, "-enable") || strings.HasSuffix(id, "-disable"):
+		return familyControls
+	case id == "manual-event" || id == "exports" || strings.HasPrefix(id, "export-") || id == "archive-count":
+		return familyRecordings
+	default:
+		return familyEvents
+	}
+}
+
+// rejectedCommand answers a command for an entity the camera filters or
+// profile exclude, with the ok and error fields every command result has.
+type rejectedCommand struct {
+	OK     bool   `json:"ok"`
+	Camera string `json:"camera"`
+	Error  string `json:"error"`
+}
+
+// entityAllowed reports whether the camera filters and profile keep an
+// entity. Reconciles delete the entities they drop as stale, and commands
+// for them are rejected.
+func (a *App) entityAllowed(entity domain.Entity) bool {
+	if entity.DeviceID == PluginDeviceID || !a.ownsDevice(entity.DeviceID) {
+		return true
+	}
+	camera := a.cameraForDevice(entity.DeviceID)
+	if !a.config.Cameras.includes(camera) {
+		return false
+	}
+	families, limited := profileFamilies[a.config.Cameras.profile(camera)]
+	if !limited {
+		return true
+	}
+	_, ok := families[entityFamily(entity.ID)]
+	return ok
+}
+
+// allowedEntities drops the entities entityAllowed rejects. The code that
+// builds a camera's entities applies it before saving them.
+func (a *App) allowedEntities(entities []domain.Entity) []domain.Entity {
+	var kept []domain.Entity
+	for _, entity := range entities {
+		if a.entityAllowed(entity) {
+			kept = append(kept, entity)
+		}
+	}
+	return kept
+}
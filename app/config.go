@@ -0,0 +1,327 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// configFile is read from the working directory and watched for changes.
+const configFile = "config.json"
+
+const maxTimeoutMS = 10 * 60 * 1000
+
+// Config sources, reported by the diagnostics entity.
+const (
+	sourceEnv        = "FRIGATE_CONFIG"
+	sourceFile       = configFile
+	sourceVariables  = "environment"
+	defaultMQTTTopic = "frigate"
+)
+
+// DiagnosticsState reports whether the loaded config is valid. Rejected is
+// set when a reload failed and the previous config is still running.
+type DiagnosticsState struct {
+	Valid    bool     `json:"valid"`
+	Source   string   `json:"source,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Rejected bool     `json:"rejected,omitempty"`
+}
+
+// readConfig builds the config in order of precedence:
+//
+//  1. FRIGATE_CONFIG holds the whole config as JSON. When set, config.json
+//     is not read.
+//  2. Otherwise config.json in the working directory, if present.
+//  3. FRIGATE_* variables that are set override single fields of either.
+//     Unset variables leave the JSON values alone.
+//
+// Credential references are resolved last, so a variable may hold one too.
+// Malformed variables and unreadable secrets are kept as problems for
+// Validate rather than being dropped.
+func readConfig() (FrigateConfig, error) {
+	var config FrigateConfig
+	config.source = sourceVariables
+	if configJSON := os.Getenv("FRIGATE_CONFIG"); configJSON != "" {
+		config.source = sourceEnv
+		if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+			return config, fmt.Errorf("FRIGATE_CONFIG: %w", err)
+		}
+	} else if data, err := os.ReadFile(configFile); err == nil {
+		config.source = sourceFile
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("%s: %w", configFile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return config, err
+	}
+
+	setString := func(name string, field *string) {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	setString("FRIGATE_URL", &config.URL)
+	setString("FRIGATE_GO2RTC_URL", &config.Go2RTCURL)
+	setString("FRIGATE_USERNAME", &config.Username)
+	setString("FRIGATE_PASSWORD", &config.Password)
+	setString("FRIGATE_MQTT_HOST", &config.MQTT.Host)
+	setString("FRIGATE_MQTT_PORT", &config.MQTT.Port)
+	setString("FRIGATE_MQTT_USER", &config.MQTT.User)
+	setString("FRIGATE_MQTT_PASSWORD", &config.MQTT.Password)
+	setString("FRIGATE_MQTT_TOPIC_PREFIX", &config.MQTT.TopicPrefix)
+	if value := os.Getenv("FRIGATE_TIMEOUT_MS"); value != "" {
+		if timeout, err := strconv.Atoi(value); err == nil {
+			config.Timeout = timeout
+		} else {
+			config.readErrors = append(config.readErrors, fmt.Sprintf("FRIGATE_TIMEOUT_MS %q is not a number of milliseconds", value))
+		}
+	}
+	if value := os.Getenv("FRIGATE_RECONCILE_INTERVAL"); value != "" {
+		if seconds, err := parseInterval(value); err == nil {
+			config.ReconcileIntervalSeconds = seconds
+		} else {
+			config.readErrors = append(config.readErrors, "FRIGATE_RECONCILE_INTERVAL "+err.Error())
+		}
+	}
+	if config.MQTT.TopicPrefix == "" {
+		config.MQTT.TopicPrefix = defaultMQTTTopic
+	}
+	config.readErrors = append(config.readErrors, config.resolveSecrets()...)
+	return config, nil
+}
+
+// Validate reports every problem in the config at once. A config that fails
+// validation on reload leaves the running config in place; at startup the
+// problems are logged and published to the diagnostics entity.
+func (c FrigateConfig) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c FrigateConfig) problems() []string {
+	problems := append([]string(nil), c.readErrors...)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Instances) > 0 {
+		if c.URL != "" {
+			add("url and instances are mutually exclusive; move url into an instance")
+		}
+		if c.Go2RTCURL != "" || c.Username != "" || c.Password != "" || c.UsernameFile != "" || c.PasswordFile != "" {
+			add("go2rtc_url and credentials belong to each instance, not next to instances")
+		}
+		if c.MQTT.Host != "" || c.MQTT.Port != "" || c.MQTT.User != "" || c.MQTT.Password != "" || c.MQTT.UserFile != "" || c.MQTT.PasswordFile != "" {
+			add("mqtt belongs to each instance, not next to instances")
+		}
+		seen := make(map[string]struct{})
+		for _, inst := range c.Instances {
+			if !instanceNamePattern.MatchString(inst.Name) {
+				add("instance %q: name must be lowercase letters, digits and dashes", inst.Name)
+				continue
+			}
+			if _, dup := seen[inst.Name]; dup {
+				add("instance %q: duplicate name", inst.Name)
+				continue
+			}
+			seen[inst.Name] = struct{}{}
+			if inst.URL == "" {
+				add("instance %q: url is required", inst.Name)
+			}
+			if len(inst.Instances) > 0 {
+				add("instance %q: instances cannot be nested", inst.Name)
+			}
+			for _, problem := range c.inherit(inst).serverProblems() {
+				add("instance %q: %s", inst.Name, problem)
+			}
+		}
+	} else {
+		if c.URL == "" {
+			add("url is required; set it in %s, FRIGATE_CONFIG or FRIGATE_URL", configFile)
+		}
+		problems = append(problems, c.serverProblems()...)
+	}
+
+	if c.Media.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Media.Listen); err != nil {
+			add("media.listen %q must be host:port", c.Media.Listen)
+		}
+	}
+	if c.Media.PublicURL != "" {
+		if err := validateHTTPURL("media.public_url", c.Media.PublicURL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.ReconcileIntervalSeconds < 0 {
+		add("reconcile_interval_seconds must not be negative")
+	}
+	if c.ReconcileJitterSeconds < 0 {
+		add("reconcile_jitter_seconds must not be negative")
+	}
+	if c.Deletion.MaxRatio < 0 || c.Deletion.MaxRatio > 1 {
+		add("deletion.max_ratio %v must be between 0 and 1", c.Deletion.MaxRatio)
+	}
+	return problems
+}
+
+// serverProblems checks the settings that describe one Frigate server.
+func (c FrigateConfig) serverProblems() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if c.URL != "" {
+		if err := validateHTTPURL("url", c.URL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.Go2RTCURL != "" {
+		if err := validateHTTPURL("go2rtc_url", c.Go2RTCURL); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.Username != "" && c.Password == "" {
+		add("username is set without password")
+	}
+	if c.Timeout < 0 || c.Timeout > maxTimeoutMS {
+		add("timeout_ms %d must be between 0 and %d", c.Timeout, maxTimeoutMS)
+	}
+
+	if c.MQTT.Port != "" && !validPort(c.MQTT.Port) {
+		add("mqtt.port %q is not a valid port", c.MQTT.Port)
+	}
+	if c.MQTT.Host == "" && (c.MQTT.Port != "" || c.MQTT.User != "") {
+		add("mqtt.port and mqtt.user need mqtt.host")
+	}
+	if prefix := c.MQTT.TopicPrefix; prefix != "" {
+		if strings.ContainsAny(prefix, "+#\x00") || strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+			add("mqtt.topic_prefix %q must not contain + or # or start or end with /", prefix)
+		}
+	}
+
+	if c.RTSP.Port != 0 && !validPort(strconv.Itoa(c.RTSP.Port)) {
+		add("rtsp.port %d is not a valid port", c.RTSP.Port)
+	}
+	if c.RTSP.RTSPSPort != 0 && !validPort(strconv.Itoa(c.RTSP.RTSPSPort)) {
+		add("rtsp.rtsps_port %d is not a valid port", c.RTSP.RTSPSPort)
+	}
+	if c.RTSP.RTSPS && !c.RTSP.Enabled {
+		add("rtsp.rtsps needs rtsp.enabled")
+	}
+
+	if len(c.Archive.Rules) > 0 && c.Archive.Dir == "" {
+		add("archive.rules need archive.dir")
+	}
+	for i, rule := range c.Archive.Rules {
+		for _, clock := range []string{rule.After, rule.Before} {
+			if _, ok := parseClock(clock); clock != "" && !ok {
+				add("archive.rules[%d]: %q is not HH:MM", i, clock)
+			}
+		}
+	}
+	if c.StreamHealth.IntervalSeconds < 0 {
+		add("stream_health.interval_seconds must not be negative")
+	}
+
+	if c.StaleEvents.MaxAgeSeconds < 0 || c.StaleEvents.IntervalSeconds < 0 {
+		add("stale_events.max_age_seconds and interval_seconds must not be negative")
+	}
+	if c.Counters.Timezone != "" {
+		if _, err := time.LoadLocation(c.Counters.Timezone); err != nil {
+			add("counters.timezone %q is not a known timezone", c.Counters.Timezone)
+		}
+	}
+
+	problems = append(problems, c.Labels.problems()...)
+	problems = append(problems, c.Occupancy.problems()...)
+	problems = append(problems, c.Speed.problems()...)
+
+	for _, pattern := range append(append([]string(nil), c.Cameras.Include...), c.Cameras.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			add("cameras: bad glob %q", pattern)
+		}
+	}
+	if !validProfile(c.Cameras.Profile) {
+		add("cameras.profile %q must be minimal, standard or full", c.Cameras.Profile)
+	}
+	overridden := make([]string, 0, len(c.Cameras.Overrides))
+	for camera := range c.Cameras.Overrides {
+		overridden = append(overridden, camera)
+	}
+	sort.Strings(overridden)
+	for _, camera := range overridden {
+		if override := c.Cameras.Overrides[camera]; !validProfile(override.Profile) {
+			add("cameras.overrides[%q].profile %q must be minimal, standard or full", camera, override.Profile)
+		}
+	}
+	return problems
+}
+
+func validPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port >= 1 && port <= 65535
+}
+
+func validateHTTPURL(field, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s %q must use http or https", field, raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s %q has no host", field, raw)
+	}
+	return nil
+}
+
+func (a *App) diagnosticsEntity() domain.Entity {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return domain.Entity{
+		ID:       "diagnostics",
+		Plugin:   PluginID,
+		DeviceID: PluginDeviceID,
+		Type:     "frigate_diagnostics",
+		Name:     "Config Diagnostics",
+		State:    a.diagnostics,
+	}
+}
+
+// setDiagnostics records the outcome of loading a config and, once the
+// plugin device exists, publishes it.
+func (a *App) setDiagnostics(source string, problems []string, rejected bool) {
+	for i, problem := range problems {
+		problems[i] = redact(problem)
+		log.Printf("plugin-frigate: config: %s", problems[i])
+	}
+	a.mu.Lock()
+	a.diagnostics = DiagnosticsState{
+		Valid:    len(problems) == 0,
+		Source:   source,
+		Errors:   problems,
+		Rejected: rejected,
+	}
+	a.mu.Unlock()
+	if a.cmds == nil {
+		return
+	}
+	if _, err := a.saveEntityIfChanged(a.diagnosticsEntity()); err != nil {
+		log.Printf("plugin-frigate: failed to save config diagnostics: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+const (
+	counterBucket    = 15 * time.Minute
+	counterRetention = 7 * 24 * time.Hour
+)
+
+// CountersConfig sets the timezone whose midnight starts the "today"
+// window. It defaults to the plugin's local time.
+type CountersConfig struct {
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (c CountersConfig) location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// WindowCountsState counts the events of one camera, label or zone over
+// fixed windows.
+type WindowCountsState struct {
+	Value    string `json:"value"`
+	Today    int    `json:"today"`
+	LastHour int    `json:"last_hour"`
+	Last24h  int    `json:"last_24h"`
+	Last7d   int    `json:"last_7d"`
+}
+
+// windowCounter counts events in 15-minute buckets keyed by the bucket's
+// Unix start time. Buckets older than seven days are dropped, so a counter
+// holds at most 672 entries.
+type windowCounter map[int64]int
+
+func bucketStart(t time.Time) int64 {
+	return t.Truncate(counterBucket).Unix()
+}
+
+func (w windowCounter) add(at time.Time) {
+	w[bucketStart(at)]++
+	w.prune(at)
+}
+
+func (w windowCounter) prune(now time.Time) {
+	cutoff := now.Add(-counterRetention).Unix()
+	for start := range w {
+		if start+int64(counterBucket/time.Second) <= cutoff {
+			delete(w, start)
+		}
+	}
+}
+
+// since sums the buckets that overlap [from, now]. Windows are therefore
+// accurate to one bucket.
+func (w windowCounter) since(from time.Time) int {
+	total := 0
+	for start, n := range w {
+		if start+int64(counterBucket/time.Second) > from.Unix() {
+			total += n
+		}
+	}
+	return total
+}
+
+func (w windowCounter) clone() windowCounter {
+	out := make(windowCounter, len(w))
+	for start, n := range w {
+		out[start] = n
+	}
+	return out
+}
+
+func (w windowCounter) merge(other windowCounter) {
+	for start, n := range other {
+		w[start] += n
+	}
+}
+
+func (w windowCounter) state(now time.Time, loc *time.Location) WindowCountsState {
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	state := WindowCountsState{
+		Today:    w.since(midnight),
+		LastHour: w.since(now.Add(-time.Hour)),
+		Last24h:  w.since(now.Add(-24 * time.Hour)),
+		Last7d:   w.since(now.Add(-counterRetention)),
+	}
+	state.Value = fmt.Sprintf("%d today", state.Today)
+	return state
+}
+
+func (r *cameraRuntime) zone(name string) windowCounter {
+	if r.Zones == nil {
+		r.Zones = make(map[string]windowCounter)
+	}
+	if r.Zones[name] == nil {
+		r.Zones[name] = make(windowCounter)
+	}
+	return r.Zones[name]
+}
+
+// countZones records the zones an event entered since its previous update.
+func (r *cameraRuntime) countZones(previous *Event, event Event, at time.Time) {
+	seen := make(map[string]struct{})
+	if previous != nil {
+		for _, zone := range previous.allZones() {
+			seen[zone] = struct{}{}
+		}
+	}
+	for _, zone := range event.allZones() {
+		if _, ok := seen[zone]; !ok {
+			r.zone(zone).add(at)
+		}
+	}
+}
+
+// SetClock replaces the time source of the runtime counters, for tests.
+func (a *App) SetClock(now func() time.Time) {
+	a.now = now
+	for _, inst := range a.instances {
+		inst.now = now
+	}
+}
+
+// refreshCounters re-syncs the runtime entities of every camera once the
+// clock enters a new counter bucket or a new day since last, so windows
+// move on and "today" resets on cameras without events. It returns the
+// time of the latest sync.
+func (a *App) refreshCounters(last time.Time) time.Time {
+	now := a.now()
+	loc := a.config.Counters.location()
+	if bucketStart(now) == bucketStart(last) && now.In(loc).YearDay() == last.In(loc).YearDay() {
+		return last
+	}
+
+	a.mu.Lock()
+	cameras := make([]string, 0, len(a.runtime))
+	for camera := range a.runtime {
+		cameras = append(cameras, camera)
+	}
+	a.mu.Unlock()
+	sort.Strings(cameras)
+	for _, camera := range cameras {
+		if err := a.syncRuntimeEntities(camera); err != nil {
+			log.Printf("plugin-frigate: %sfailed to sync counters of %s: %v", a.logPrefix(), camera, err)
+		}
+	}
+	return now
+}
+
+// counterEntities exposes the windowed counts of the camera, each label
+// and each zone.
+func (a *App) counterEntities(camera string, runtime *cameraRuntime) []domain.Entity {
+	now := a.now()
+	loc := a.config.Counters.location()
+	entity := func(id, name string, counts windowCounter) domain.Entity {
+		return domain.Entity{
+			ID:       id,
+			Plugin:   PluginID,
+			DeviceID: a.deviceID(camera),
+			Type:     "frigate_window_counts",
+			Name:     name,
+			State:    counts.state(now, loc),
+		}
+	}
+
+	all := make(windowCounter)
+	var entities []domain.Entity
+	for _, label := range a.runtimeLabels(runtime) {
+		counts := make(windowCounter)
+		if runtime != nil {
+			if item := runtime.ByLabel[label]; item != nil {
+				counts = item.Windows
+			}
+		}
+		all.merge(counts)
+		entities = append(entities, entity("counts-"+sanitizeID(label), strings.Title(label)+" Counts", counts))
+	}
+	if runtime != nil {
+		zones := make([]string, 0, len(runtime.Zones))
+		for zone := range runtime.Zones {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+		for _, zone := range zones {
+			name := strings.Title(strings.ReplaceAll(zone, "_", " "))
+			entities = append(entities, entity("counts-zone-"+sanitizeID(zone), name+" Zone Counts", runtime.Zones[zone]))
+		}
+	}
+	return append([]domain.Entity{entity("counts-all", "All Counts", all)}, entities...)
+}
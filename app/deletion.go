@@ -0,0 +1,157 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	domain "github.com/slidebolt/sb-domain"
+	storage "github.com/slidebolt/sb-storage-sdk"
+)
+
+const (
+	defaultDeletionGrace    = 3
+	defaultDeletionMaxRatio = 0.5
+	// deletionGuardMinCameras is the fewest stored cameras for which the
+	// ratio guard applies while Frigate still reports some cameras.
+	deletionGuardMinCameras = 3
+)
+
+// DeletionConfig protects stored cameras from transient gaps in Frigate's
+// config. A camera missing from /api/config is marked unavailable and only
+// deleted after GraceReconciles consecutive reconciles without it. When more
+// than MaxRatio of the known cameras are missing at once nothing is deleted,
+// as long as Frigate reports no cameras at all or at least
+// deletionGuardMinCameras are known; with fewer, renaming or retiring one
+// camera would otherwise be blocked for good.
+type DeletionConfig struct {
+	GraceReconciles int     `json:"grace_reconciles,omitempty"`
+	MaxRatio        float64 `json:"max_ratio,omitempty"`
+}
+
+func (c DeletionConfig) grace() int {
+	if c.GraceReconciles > 0 {
+		return c.GraceReconciles
+	}
+	return defaultDeletionGrace
+}
+
+func (c DeletionConfig) maxRatio() float64 {
+	if c.MaxRatio > 0 {
+		return c.MaxRatio
+	}
+	return defaultDeletionMaxRatio
+}
+
+func missingKey(deviceID string) rawKey {
+	return rawKey(PluginID + ".missing." + deviceID)
+}
+
+// loadMissingLocked reads the persisted missing counters once, so the grace
+// period survives plugin restarts. Callers hold a.mu.
+func (a *App) loadMissingLocked() {
+	if a.missing != nil {
+		return
+	}
+	a.missing = make(map[string]int)
+	entries, err := a.store.SearchFiles(storage.Internal, PluginID+".missing.>")
+	if err != nil {
+		log.Printf("plugin-frigate: failed to load missing camera counters: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		device := strings.TrimPrefix(entry.Key, PluginID+".missing.")
+		if !a.keepsMissing(device) {
+			continue
+		}
+		var count int
+		if err := json.Unmarshal(entry.Data, &count); err == nil {
+			a.missing[device] = count
+		}
+	}
+}
+
+// staleDevices decides which of the stored devices that Frigate no longer
+// reports may be deleted now. The rest are kept and marked unavailable.
+func (a *App) staleDevices(stored, desired map[string]struct{}) map[string]struct{} {
+	var missing []string
+	for device := range stored {
+		if _, ok := desired[device]; !ok {
+			missing = append(missing, device)
+		}
+	}
+	sort.Strings(missing)
+
+	// A guarded round says more about Frigate than about the cameras, so it
+	// does not count towards their grace period.
+	guard := len(missing) > 0 && float64(len(missing))/float64(len(stored)) > a.config.Deletion.maxRatio() &&
+		(len(desired) == 0 || len(stored) >= deletionGuardMinCameras)
+	if guard {
+		log.Printf("plugin-frigate: %s%d of %d cameras missing from Frigate config, not deleting any",
+			a.logPrefix(), len(missing), len(stored))
+	}
+
+	a.mu.Lock()
+	a.loadMissingLocked()
+	var cleared []string
+	for device := range a.missing {
+		if _, ok := desired[device]; ok {
+			cleared = append(cleared, device)
+			delete(a.missing, device)
+		}
+	}
+	counts := make(map[string]int, len(missing))
+	for _, device := range missing {
+		if !guard {
+			a.missing[device]++
+		}
+		counts[device] = a.missing[device]
+	}
+	a.mu.Unlock()
+
+	for _, device := range cleared {
+		if err := a.store.DeleteInternal(missingKey(device)); err != nil {
+			log.Printf("plugin-frigate: failed to clear missing counter for %s: %v", device, err)
+		}
+	}
+
+	due := make(map[string]struct{})
+	for _, device := range missing {
+		if !guard && counts[device] >= a.config.Deletion.grace() {
+			due[device] = struct{}{}
+			a.mu.Lock()
+			delete(a.missing, device)
+			a.mu.Unlock()
+			if err := a.store.DeleteInternal(missingKey(device)); err != nil {
+				log.Printf("plugin-frigate: failed to clear missing counter for %s: %v", device, err)
+			}
+			continue
+		}
+		if err := a.store.SetInternal(missingKey(device), []byte(strconv.Itoa(counts[device]))); err != nil {
+			log.Printf("plugin-frigate: failed to store missing counter for %s: %v", device, err)
+		}
+		a.markUnavailable(device)
+	}
+	return due
+}
+
+func (a *App) markUnavailable(deviceID string) {
+	entity := domain.Entity{
+		ID:       "availability",
+		Plugin:   PluginID,
+		DeviceID: deviceID,
+		Type:     "frigate_availability",
+		Name:     "Availability",
+		State:    AvailabilityState{Available: false},
+	}
+	changed, err := a.saveEntityIfChanged(entity)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to mark %s unavailable: %v", deviceID, err)
+		return
+	}
+	if changed {
+		log.Printf("plugin-frigate: camera %s missing from Frigate config, marked unavailable", deviceID)
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// SnapshotOptions controls the query string of event snapshot URLs.
+type SnapshotOptions struct {
+	Crop    bool `json:"crop,omitempty"`
+	BBox    bool `json:"bbox,omitempty"`
+	Quality int  `json:"quality,omitempty"`
+	Height  int  `json:"height,omitempty"`
+}
+
+func (o SnapshotOptions) query() string {
+	values := url.Values{}
+	if o.Crop {
+		values.Set("crop", "1")
+	}
+	if o.BBox {
+		values.Set("bbox", "1")
+	}
+	if o.Quality > 0 {
+		values.Set("quality", strconv.Itoa(o.Quality))
+	}
+	if o.Height > 0 {
+		values.Set("h", strconv.Itoa(o.Height))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+type ClipState struct {
+	URL     string `json:"url"`
+	Format  string `json:"format,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+	Online  bool   `json:"online"`
+}
+
+func eventMediaPath(eventID, file string) string {
+	return fmt.Sprintf("/api/events/%s/%s", url.PathEscape(eventID), file)
+}
+
+// eventMediaEntities exposes the snapshot, thumbnail and clip of each label's
+// most recent event. They go online as soon as Frigate reports the media.
+func (a *App) eventMediaEntities(camera string, runtime *cameraRuntime) []domain.Entity {
+	labels := a.runtimeLabels(runtime)
+	entities := make([]domain.Entity, 0, len(labels)*3)
+	for _, label := range labels {
+		item := runtime.label(label)
+		id := sanitizeID(label)
+		title := strings.Title(label)
+
+		snapshot := ImageState{Format: "jpeg"}
+		thumbnail := ImageState{Format: "jpeg"}
+		clip := ClipState{Format: "mp4"}
+		if event := item.LastEvent; event != nil && event.ID != "" {
+			snapshot.EventID = event.ID
+			snapshot.URL = a.imageURL(camera, "snapshot.jpg", event.ID)
+			snapshot.Online = event.HasSnapshot
+
+			thumbnail.EventID = event.ID
+			thumbnail.URL = a.imageURL(camera, "thumbnail.jpg", event.ID)
+			thumbnail.Online = true
+
+			clip.EventID = event.ID
+			clip.URL = a.apiURL(eventMediaPath(event.ID, "clip.mp4"))
+			clip.Online = event.HasClip
+		}
+
+		entities = append(entities,
+			domain.Entity{
+				ID:       "image-" + id + "-snapshot",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_image",
+				Name:     title + " Snapshot",
+				State:    snapshot,
+			},
+			domain.Entity{
+				ID:       "image-" + id + "-thumbnail",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_image",
+				Name:     title + " Thumbnail",
+				State:    thumbnail,
+			},
+			domain.Entity{
+				ID:       "clip-" + id,
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_clip",
+				Name:     title + " Clip",
+				State:    clip,
+			},
+		)
+	}
+	return entities
+}
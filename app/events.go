@@ -0,0 +1,279 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+// CameraCreateEvent asks Frigate to create a manual event on a camera, e.g.
+// when a doorbell on another plugin is pressed. Duration is in seconds; when
+// zero the event stays open until frigate_end_event is sent.
+type CameraCreateEvent struct {
+	Label            string     `json:"label"`
+	SubLabel         string     `json:"sub_label,omitempty"`
+	Duration         int        `json:"duration,omitempty"`
+	Score            float64    `json:"score,omitempty"`
+	IncludeRecording *bool      `json:"include_recording,omitempty"`
+	Draw             *EventDraw `json:"draw,omitempty"`
+}
+
+func (c CameraCreateEvent) validate() error {
+	if strings.TrimSpace(c.Label) == "" {
+		return fmt.Errorf("label is required")
+	}
+	if c.Duration < 0 {
+		return fmt.Errorf("duration %d must not be negative", c.Duration)
+	}
+	if c.Score < 0 || c.Score > 1 {
+		return fmt.Errorf("score %.2f out of range [0,1]", c.Score)
+	}
+	return nil
+}
+
+// CameraEndEvent ends a manual event. An empty EventID ends the last event
+// created on the camera; a zero EndTime means now.
+type CameraEndEvent struct {
+	EventID string  `json:"event_id,omitempty"`
+	EndTime float64 `json:"end_time,omitempty"`
+}
+
+type EventDraw struct {
+	Boxes []EventDrawBox `json:"boxes,omitempty"`
+}
+
+type EventDrawBox struct {
+	Box   []float64 `json:"box"`
+	Color []int     `json:"color,omitempty"`
+	Score float64   `json:"score,omitempty"`
+}
+
+// ManualEventState tracks the last event created through SlideBolt so that
+// automations on other plugins can see which event id marks their moment.
+// Active reports an open-ended event that still needs frigate_end_event.
+type ManualEventState struct {
+	LastEventID string `json:"last_event_id,omitempty"`
+	Label       string `json:"label,omitempty"`
+	SubLabel    string `json:"sub_label,omitempty"`
+	StartedAt   string `json:"started_at,omitempty"`
+	EndedAt     string `json:"ended_at,omitempty"`
+	Active      bool   `json:"active"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// ManualEventResult is the reply sent to request/reply callers of
+// frigate_create_event and frigate_end_event.
+type ManualEventResult struct {
+	OK      bool   `json:"ok"`
+	EventID string `json:"event_id,omitempty"`
+	Camera  string `json:"camera"`
+	Label   string `json:"label,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type createEventRequest struct {
+	SourceType       string     `json:"source_type,omitempty"`
+	SubLabel         string     `json:"sub_label,omitempty"`
+	Score            float64    `json:"score,omitempty"`
+	Duration         *int       `json:"duration"`
+	IncludeRecording *bool      `json:"include_recording,omitempty"`
+	Draw             *EventDraw `json:"draw,omitempty"`
+}
+
+func (c *FrigateClient) CreateEvent(ctx context.Context, camera, label string, cmd CameraCreateEvent) (string, error) {
+	body := createEventRequest{
+		SourceType:       "api",
+		SubLabel:         cmd.SubLabel,
+		Score:            cmd.Score,
+		IncludeRecording: cmd.IncludeRecording,
+		Draw:             cmd.Draw,
+	}
+	if cmd.Duration > 0 {
+		duration := cmd.Duration
+		body.Duration = &duration
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("create event: %w", err)
+	}
+
+	path := fmt.Sprintf("/api/events/%s/%s/create", url.PathEscape(camera), url.PathEscape(label))
+	resp, err := c.post(ctx, path, data)
+	if err != nil {
+		return "", fmt.Errorf("create event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("create event: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		EventID string `json:"event_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode create event: %w", err)
+	}
+	if !result.Success || result.EventID == "" {
+		return "", fmt.Errorf("create event: %s", result.Message)
+	}
+	return result.EventID, nil
+}
+
+func (c *FrigateClient) EndEvent(ctx context.Context, eventID string, endTime float64) error {
+	var body []byte
+	if endTime > 0 {
+		body, _ = json.Marshal(map[string]float64{"end_time": endTime})
+	}
+
+	path := fmt.Sprintf("/api/events/%s/end", url.PathEscape(eventID))
+	resp, err := c.put(ctx, path, body)
+	if err != nil {
+		return fmt.Errorf("end event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("end event: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (a *App) handleCreateEvent(cameraID string, cmd CameraCreateEvent, msg *messenger.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	label := strings.ToLower(strings.TrimSpace(cmd.Label))
+	result := ManualEventResult{Camera: cameraID, Label: label}
+	if err := cmd.validate(); err != nil {
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+
+	eventID, err := a.client.CreateEvent(ctx, cameraID, label, cmd)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to create event for %s: %v", cameraID, err)
+		result.Error = redactError(err)
+		a.updateManualEvent(cameraID, func(s *ManualEventState) {
+			s.LastError = redactError(err)
+		})
+		reply(msg, result)
+		return
+	}
+
+	log.Printf("plugin-frigate: created %s event %s for camera %s", label, eventID, cameraID)
+
+	result.OK = true
+	result.EventID = eventID
+	started := time.Now().UTC().Format(time.RFC3339)
+	a.updateManualEvent(cameraID, func(s *ManualEventState) {
+		*s = ManualEventState{
+			LastEventID: eventID,
+			Label:       label,
+			SubLabel:    cmd.SubLabel,
+			StartedAt:   started,
+			Active:      cmd.Duration == 0,
+		}
+		if cmd.Duration > 0 {
+			s.EndedAt = time.Now().Add(time.Duration(cmd.Duration) * time.Second).UTC().Format(time.RFC3339)
+		}
+	})
+	reply(msg, result)
+}
+
+func (a *App) handleEndEvent(cameraID string, cmd CameraEndEvent, msg *messenger.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	eventID := cmd.EventID
+	if eventID == "" {
+		eventID = a.runtimeSnapshot(cameraID).Manual.LastEventID
+	}
+	result := ManualEventResult{Camera: cameraID, EventID: eventID}
+	if eventID == "" {
+		result.Error = "no event to end"
+		reply(msg, result)
+		return
+	}
+
+	if err := a.client.EndEvent(ctx, eventID, cmd.EndTime); err != nil {
+		log.Printf("plugin-frigate: failed to end event %s for %s: %v", eventID, cameraID, err)
+		result.Error = redactError(err)
+		a.updateManualEvent(cameraID, func(s *ManualEventState) {
+			s.LastError = redactError(err)
+		})
+		reply(msg, result)
+		return
+	}
+
+	log.Printf("plugin-frigate: ended event %s for camera %s", eventID, cameraID)
+
+	result.OK = true
+	ended := time.Now().UTC()
+	if cmd.EndTime > 0 {
+		ended = time.Unix(int64(cmd.EndTime), 0).UTC()
+	}
+	a.updateManualEvent(cameraID, func(s *ManualEventState) {
+		if s.LastEventID != eventID {
+			return
+		}
+		s.Active = false
+		s.EndedAt = ended.Format(time.RFC3339)
+		s.LastError = ""
+	})
+	reply(msg, result)
+}
+
+// updateManualEvent applies update to the camera's manual event runtime and
+// writes the resulting state to the manual-event entity.
+func (a *App) updateManualEvent(cameraID string, update func(*ManualEventState)) {
+	a.mu.Lock()
+	runtime := a.cameraRuntimeLocked(cameraID)
+	update(&runtime.Manual)
+	state := runtime.Manual
+	a.mu.Unlock()
+
+	if _, err := a.saveEntityIfChanged(manualEventEntity(a.deviceID(cameraID), state)); err != nil {
+		log.Printf("plugin-frigate: failed to update manual event for %s: %v", cameraID, err)
+	}
+}
+
+func manualEventEntity(deviceID string, state ManualEventState) domain.Entity {
+	return domain.Entity{
+		ID:       "manual-event",
+		Plugin:   PluginID,
+		DeviceID: deviceID,
+		Type:     "frigate_manual_event",
+		Name:     "Manual Event",
+		Commands: []string{"frigate_create_event", "frigate_end_event"},
+		State:    state,
+	}
+}
+
+// reply answers a request/reply command. Fire-and-forget commands carry no
+// reply subject, so a failed Respond is not an error worth reporting.
+func reply(msg *messenger.Message, v any) {
+	if msg == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to marshal reply: %v", err)
+		return
+	}
+	_ = msg.Respond(data)
+}
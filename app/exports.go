@@ -0,0 +1,423 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+const (
+	// DefaultExportWindow is the range exported when frigate_export carries
+	// neither an absolute range nor a relative one.
+	DefaultExportWindow = 5 * time.Minute
+
+	exportPollInterval = 5 * time.Second
+	exportWatchTimeout = 30 * time.Minute
+	maxTrackedExports  = 20
+)
+
+// errExportsUnsupported is returned by GetExports on Frigate versions
+// without /api/exports.
+var errExportsUnsupported = errors.New("exports not supported")
+
+// CameraExport starts a recording export. Either Start/End (unix seconds) or
+// Last (a Go duration such as "5m", ending now) selects the range.
+type CameraExport struct {
+	Start    float64 `json:"start,omitempty"`
+	End      float64 `json:"end,omitempty"`
+	Last     string  `json:"last,omitempty"`
+	Playback string  `json:"playback,omitempty"`
+	Source   string  `json:"source,omitempty"`
+	Name     string  `json:"name,omitempty"`
+}
+
+// resolveRange turns the command into an absolute [start, end] range.
+func (c CameraExport) resolveRange(now time.Time) (int64, int64, error) {
+	if c.Start > 0 || c.End > 0 {
+		if c.Last != "" {
+			return 0, 0, fmt.Errorf("use either start/end or last, not both")
+		}
+		end := c.End
+		if end == 0 {
+			end = float64(now.Unix())
+		}
+		if c.Start <= 0 || end <= c.Start {
+			return 0, 0, fmt.Errorf("invalid range %.0f-%.0f", c.Start, end)
+		}
+		return int64(c.Start), int64(end), nil
+	}
+
+	window := DefaultExportWindow
+	if c.Last != "" {
+		d, err := time.ParseDuration(c.Last)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid last %q: %w", c.Last, err)
+		}
+		if d <= 0 {
+			return 0, 0, fmt.Errorf("last %q must be positive", c.Last)
+		}
+		window = d
+	}
+	return now.Add(-window).Unix(), now.Unix(), nil
+}
+
+func (c CameraExport) validate() error {
+	switch c.Playback {
+	case "", "realtime", "timelapse_25x":
+	default:
+		return fmt.Errorf("unsupported playback %q", c.Playback)
+	}
+	switch c.Source {
+	case "", "recordings", "preview":
+	default:
+		return fmt.Errorf("unsupported source %q", c.Source)
+	}
+	return nil
+}
+
+// ExportResult is the reply sent to request/reply callers of frigate_export.
+type ExportResult struct {
+	OK       bool   `json:"ok"`
+	Camera   string `json:"camera"`
+	ExportID string `json:"export_id,omitempty"`
+	Start    int64  `json:"start,omitempty"`
+	End      int64  `json:"end,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Export is one entry of Frigate's /api/exports list.
+type Export struct {
+	ID         string  `json:"id"`
+	Camera     string  `json:"camera"`
+	Name       string  `json:"name"`
+	Date       float64 `json:"date"`
+	VideoPath  string  `json:"video_path"`
+	ThumbPath  string  `json:"thumb_path"`
+	InProgress bool    `json:"in_progress"`
+}
+
+type ExportItem struct {
+	ID           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	Date         string `json:"date,omitempty"`
+	InProgress   bool   `json:"in_progress"`
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+type ExportsState struct {
+	InProgress int          `json:"in_progress"`
+	Completed  int          `json:"completed"`
+	Exports    []ExportItem `json:"exports,omitempty"`
+	LastError  string       `json:"last_error,omitempty"`
+}
+
+type exportRequest struct {
+	Playback string `json:"playback,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+func (c *FrigateClient) StartExport(ctx context.Context, camera string, start, end int64, cmd CameraExport) (string, error) {
+	data, err := json.Marshal(exportRequest{Playback: cmd.Playback, Source: cmd.Source, Name: cmd.Name})
+	if err != nil {
+		return "", fmt.Errorf("start export: %w", err)
+	}
+
+	path := fmt.Sprintf("/api/export/%s/start/%d/end/%d", url.PathEscape(camera), start, end)
+	resp, err := c.post(ctx, path, data)
+	if err != nil {
+		return "", fmt.Errorf("start export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("start export: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Success  bool   `json:"success"`
+		Message  string `json:"message"`
+		ExportID string `json:"export_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode export: %w", err)
+	}
+	if !result.Success {
+		return "", fmt.Errorf("start export: %s", result.Message)
+	}
+	return result.ExportID, nil
+}
+
+func (c *FrigateClient) GetExports(ctx context.Context) ([]Export, error) {
+	resp, err := c.get(ctx, "/api/exports")
+	if err != nil {
+		return nil, fmt.Errorf("get exports: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get exports: %w", errExportsUnsupported)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get exports: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var exports []Export
+	if err := json.NewDecoder(resp.Body).Decode(&exports); err != nil {
+		return nil, fmt.Errorf("decode exports: %w", err)
+	}
+	return exports, nil
+}
+
+func (a *App) handleExport(cameraID string, cmd CameraExport, msg *messenger.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result := ExportResult{Camera: cameraID}
+	start, end, err := cmd.resolveRange(time.Now())
+	if err == nil {
+		err = cmd.validate()
+	}
+	if err != nil {
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+	result.Start, result.End = start, end
+
+	exportID, err := a.client.StartExport(ctx, cameraID, start, end, cmd)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to start export for %s: %v", cameraID, err)
+		result.Error = redactError(err)
+		a.updateExports(cameraID, func(s *ExportsState) {
+			s.LastError = redactError(err)
+		})
+		reply(msg, result)
+		return
+	}
+
+	log.Printf("plugin-frigate: started export %s for camera %s (%d-%d)", exportID, cameraID, start, end)
+
+	result.OK = true
+	result.ExportID = exportID
+	reply(msg, result)
+
+	a.mu.Lock()
+	a.exportStarts++
+	watch := a.ctx != nil && !a.watchingExports
+	if watch {
+		a.watchingExports = true
+	}
+	loopCtx := a.ctx
+	a.mu.Unlock()
+	if watch {
+		a.loops.Add(1)
+		go func() {
+			defer a.loops.Done()
+			a.watchExports(loopCtx)
+		}()
+	}
+}
+
+// watchExports polls /api/exports until no camera has an export in
+// progress, so the exports entities report completion without waiting for
+// the next reconcile. One watcher runs per instance; exports started while
+// it polls keep it going. It runs with the instance loops, so stopLoops
+// waits for it.
+func (a *App) watchExports(ctx context.Context) {
+	deadline := time.Now().Add(exportWatchTimeout)
+	ticker := a.newTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	stop := func() {
+		a.mu.Lock()
+		a.watchingExports = false
+		a.mu.Unlock()
+	}
+	for {
+		a.mu.Lock()
+		starts := a.exportStarts
+		a.mu.Unlock()
+		if err := a.refreshExports(ctx); err != nil {
+			log.Printf("plugin-frigate: %sexport refresh error: %v", a.logPrefix(), err)
+		} else if a.syncExports(starts) {
+			return
+		}
+		if time.Now().After(deadline) {
+			stop()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncExports writes every camera's exports entity. It reports whether the
+// watcher is done: nothing is in progress and no export started since
+// starts was read, in which case the watcher is released under the same
+// lock.
+func (a *App) syncExports(starts int) bool {
+	a.mu.Lock()
+	cameras := make([]string, 0, len(a.runtime))
+	for camera := range a.runtime {
+		cameras = append(cameras, camera)
+	}
+	a.mu.Unlock()
+	sort.Strings(cameras)
+	for _, camera := range cameras {
+		a.updateExports(camera, func(*ExportsState) {})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.exportStarts != starts {
+		return false
+	}
+	for _, runtime := range a.runtime {
+		if runtime.Exports.InProgress > 0 {
+			return false
+		}
+	}
+	a.watchingExports = false
+	return true
+}
+
+// refreshExports fetches the export list and stores it in each camera's
+// runtime. Entities are written by the caller. After Frigate answers 404
+// once, the instance stops asking until it is reconfigured.
+func (a *App) refreshExports(ctx context.Context) error {
+	a.mu.Lock()
+	unsupported := a.exportsUnsupported
+	a.mu.Unlock()
+	if unsupported {
+		return nil
+	}
+	exports, err := a.client.GetExports(ctx)
+	if errors.Is(err, errExportsUnsupported) {
+		log.Printf("plugin-frigate: %sFrigate has no /api/exports, not tracking exports", a.logPrefix())
+		a.mu.Lock()
+		a.exportsUnsupported = true
+		a.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	byCamera := make(map[string][]Export)
+	for _, export := range exports {
+		byCamera[export.Camera] = append(byCamera[export.Camera], export)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for camera, runtime := range a.runtime {
+		state := a.exportsState(byCamera[camera])
+		state.LastError = runtime.Exports.LastError
+		runtime.Exports = state
+	}
+	return nil
+}
+
+func (a *App) exportsState(exports []Export) ExportsState {
+	sort.Slice(exports, func(i, j int) bool { return exports[i].Date > exports[j].Date })
+
+	state := ExportsState{}
+	for _, export := range exports {
+		if export.InProgress {
+			state.InProgress++
+		} else {
+			state.Completed++
+		}
+		if len(state.Exports) >= maxTrackedExports {
+			continue
+		}
+		item := ExportItem{
+			ID:         export.ID,
+			Name:       export.Name,
+			InProgress: export.InProgress,
+		}
+		if export.Date > 0 {
+			item.Date = time.Unix(int64(export.Date), 0).UTC().Format(time.RFC3339)
+		}
+		if !export.InProgress && export.VideoPath != "" {
+			item.URL = a.apiURL(mediaPath(export.VideoPath))
+		}
+		if export.ThumbPath != "" {
+			item.ThumbnailURL = a.apiURL(mediaPath(export.ThumbPath))
+		}
+		state.Exports = append(state.Exports, item)
+	}
+	return state
+}
+
+// mediaPath maps a path inside Frigate's container (/media/frigate/...) to
+// the URL path Frigate serves it under.
+func mediaPath(p string) string {
+	p = strings.TrimPrefix(p, "/media/frigate")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// updateExports applies update to the camera's export runtime and writes
+// the resulting state to the exports entity, unless the camera's profile
+// leaves it out.
+func (a *App) updateExports(cameraID string, update func(*ExportsState)) {
+	a.mu.Lock()
+	runtime := a.cameraRuntimeLocked(cameraID)
+	update(&runtime.Exports)
+	state := runtime.Exports
+	a.mu.Unlock()
+
+	entity := exportsEntity(a.deviceID(cameraID), state)
+	if !a.entityAllowed(entity) {
+		return
+	}
+	if _, err := a.saveEntityIfChanged(entity); err != nil {
+		log.Printf("plugin-frigate: failed to update exports for %s: %v", cameraID, err)
+	}
+}
+
+func exportsEntity(deviceID string, state ExportsState) domain.Entity {
+	return domain.Entity{
+		ID:       "exports",
+		Plugin:   PluginID,
+		DeviceID: deviceID,
+		Type:     "frigate_exports",
+		Name:     "Exports",
+		Commands: []string{"frigate_export"},
+		State:    state,
+	}
+}
+
+func exportButtonEntity(deviceID string) domain.Entity {
+	return domain.Entity{
+		ID:       "export-last-5m",
+		Plugin:   PluginID,
+		DeviceID: deviceID,
+		Type:     "button",
+		Name:     "Save Last 5 Minutes",
+		Commands: []string{"frigate_export"},
+		State:    domain.Button{},
+	}
+}
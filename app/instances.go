@@ -0,0 +1,240 @@
+package app
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+// Instance names prefix device IDs ("<name>_<camera>"), so they may not
+// contain the underscore that separates them from the camera name.
+var instanceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// setupInstances creates one App per configured Frigate instance. Without
+// an instances list the App serves the single top-level Frigate itself and
+// device IDs stay the bare camera names.
+func (a *App) setupInstances() {
+	a.instances = nil
+	if len(a.config.Instances) == 0 {
+		a.instances = []*App{a}
+		return
+	}
+	for _, config := range a.config.instanceConfigs() {
+		a.instances = append(a.instances, a.newInstance(config))
+	}
+}
+
+// instanceConfigs returns the valid, uniquely named entries of Instances
+// with the top-level settings they inherit.
+func (c FrigateConfig) instanceConfigs() []FrigateConfig {
+	var configs []FrigateConfig
+	seen := make(map[string]struct{})
+	for _, config := range c.Instances {
+		if !instanceNamePattern.MatchString(config.Name) {
+			log.Printf("plugin-frigate: skipping instance %q: name must be lowercase letters, digits and dashes", config.Name)
+			continue
+		}
+		if _, dup := seen[config.Name]; dup {
+			log.Printf("plugin-frigate: skipping duplicate instance %q", config.Name)
+			continue
+		}
+		seen[config.Name] = struct{}{}
+		configs = append(configs, c.inherit(config))
+	}
+	return configs
+}
+
+// inherit fills the settings an instance leaves unset from the top level.
+// Server settings (url, go2rtc_url, credentials and mqtt) are not shared;
+// Validate rejects them at the top level next to instances.
+func (c FrigateConfig) inherit(inst FrigateConfig) FrigateConfig {
+	inheritField(&inst.Timeout, c.Timeout)
+	inheritField(&inst.Snapshot, c.Snapshot)
+	inheritField(&inst.Archive, c.Archive)
+	inheritField(&inst.StreamHealth, c.StreamHealth)
+	inheritField(&inst.RTSP, c.RTSP)
+	inheritField(&inst.Deletion, c.Deletion)
+	inheritField(&inst.Cameras, c.Cameras)
+	inheritField(&inst.Labels, c.Labels)
+	inheritField(&inst.Counters, c.Counters)
+	inheritField(&inst.StaleEvents, c.StaleEvents)
+	inheritField(&inst.Occupancy, c.Occupancy)
+	inheritField(&inst.Speed, c.Speed)
+	inheritField(&inst.ReconcileIntervalSeconds, c.ReconcileIntervalSeconds)
+	inheritField(&inst.ReconcileJitterSeconds, c.ReconcileJitterSeconds)
+	return inst
+}
+
+func inheritField[T any](field *T, top T) {
+	if reflect.ValueOf(*field).IsZero() {
+		*field = top
+	}
+}
+
+func (a *App) newInstance(config FrigateConfig) *App {
+	inst := New()
+	inst.name = config.Name
+	inst.config = config
+	inst.msg = a.msg
+	inst.store = a.store
+	inst.media = a.media
+	inst.reloadMu = a.reloadMu
+	inst.after = a.after
+	inst.now = a.now
+	return inst
+}
+
+// deviceID namespaces a camera name with the instance name.
+func (a *App) deviceID(camera string) string {
+	if a.name == "" {
+		return camera
+	}
+	return a.name + "_" + camera
+}
+
+func (a *App) cameraForDevice(deviceID string) string {
+	if a.name == "" {
+		return deviceID
+	}
+	return strings.TrimPrefix(deviceID, a.name+"_")
+}
+
+func (a *App) ownsDevice(deviceID string) bool {
+	if deviceID == PluginDeviceID {
+		return false
+	}
+	return a.name == "" || strings.HasPrefix(deviceID, a.name+"_")
+}
+
+// ownsKey reports whether a "<plugin>.<device>[.<entity>]" storage key
+// belongs to this instance, which scopes stale-record deletion.
+func (a *App) ownsKey(key string) bool {
+	device, _, _ := strings.Cut(strings.TrimPrefix(key, PluginID+"."), ".")
+	return a.ownsDevice(device)
+}
+
+func (a *App) instanceForDevice(deviceID string) *App {
+	for _, inst := range a.instances {
+		if inst.ownsDevice(deviceID) {
+			return inst
+		}
+	}
+	return nil
+}
+
+// removeOrphans handles the devices no configured instance owns: the bare
+// camera names left behind when a single server moves under instances, and
+// the cameras of instances that were removed or renamed. Like cameras
+// missing from Frigate's config, they are marked unavailable and deleted
+// once the grace period runs out, unless the ratio guard holds, so a typo
+// in an instance name does not wipe its devices. Without instances the App
+// owns every device and stale ones go through the reconcile instead.
+func (a *App) removeOrphans() {
+	if len(a.config.Instances) == 0 {
+		return
+	}
+	entries, err := a.store.Search(PluginID + ".>")
+	if err != nil {
+		log.Printf("plugin-frigate: failed to search for orphaned devices: %v", err)
+		return
+	}
+	stored := make(map[string]struct{})
+	owned := make(map[string]struct{})
+	orphaned := make(map[string][]string)
+	for _, entry := range entries {
+		device, _, _ := strings.Cut(strings.TrimPrefix(entry.Key, PluginID+"."), ".")
+		if device == PluginDeviceID {
+			continue
+		}
+		stored[device] = struct{}{}
+		if a.instanceForDevice(device) != nil {
+			owned[device] = struct{}{}
+			continue
+		}
+		orphaned[device] = append(orphaned[device], entry.Key)
+	}
+
+	due := a.staleDevices(stored, owned)
+	devices := make([]string, 0, len(due))
+	for device := range due {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		for _, key := range orphaned[device] {
+			if err := a.deleteStorageKey(key); err != nil {
+				log.Printf("plugin-frigate: failed to delete orphaned record %s: %v", key, err)
+			}
+		}
+		if err := a.store.DeleteInternal(runtimeKey(device)); err != nil {
+			log.Printf("plugin-frigate: failed to delete %s: %v", runtimeKey(device).Key(), err)
+		}
+		log.Printf("plugin-frigate: removed device %s, which no instance owns", device)
+	}
+}
+
+// watchOrphans runs removeOrphans on the top-level reconcile schedule of a
+// multi-instance setup, so orphaned devices run out their grace period
+// without further reloads. A round that meets a reload is skipped, since the
+// reload sweeps itself.
+func (a *App) watchOrphans() {
+	if len(a.config.Instances) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.ctx, a.cancel = ctx, cancel
+	a.loops.Add(1)
+	go func() {
+		defer a.loops.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.after(a.config.nextReconcile()):
+				if a.reloadMu.TryRLock() {
+					a.removeOrphans()
+					a.reloadMu.RUnlock()
+				}
+			}
+		}
+	}()
+}
+
+// keepsMissing reports whether this App keeps the missing counter of a
+// device: each instance for its own devices and, with instances, the top
+// level for the devices none of them owns.
+func (a *App) keepsMissing(deviceID string) bool {
+	if a.name == "" && len(a.config.Instances) > 0 {
+		return deviceID != PluginDeviceID && a.instanceForDevice(deviceID) == nil
+	}
+	return a.ownsDevice(deviceID)
+}
+
+func (a *App) logPrefix() string {
+	if a.name == "" {
+		return ""
+	}
+	return a.name + ": "
+}
+
+// routeCommand hands a command to the instance that owns its device.
+func (a *App) routeCommand(addr messenger.Address, cmd any, msg *messenger.Message) {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+
+	if addr.DeviceID == PluginDeviceID {
+		a.handlePluginCommand(addr, cmd, msg)
+		return
+	}
+	inst := a.instanceForDevice(addr.DeviceID)
+	if inst == nil {
+		log.Printf("plugin-frigate: command %T for unknown device %s", cmd, addr.Key())
+		return
+	}
+	inst.handleCommand(addr, cmd, msg)
+}
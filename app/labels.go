@@ -0,0 +1,177 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// defaultLabels are tracked for cameras whose Frigate config lists none.
+var defaultLabels = []string{"car", "person"}
+
+// LabelsConfig maps Frigate's labels onto our vocabulary. Aliases rename a
+// Frigate label everywhere (runtime counters, entity IDs and names).
+// Groups aggregate several labels, after aliasing, into their own event,
+// count and occupancy entities.
+type LabelsConfig struct {
+	Aliases map[string]string   `json:"aliases,omitempty"`
+	Groups  map[string][]string `json:"groups,omitempty"`
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
+
+// canonical returns the normalised, aliased form of a Frigate label.
+func (c LabelsConfig) canonical(label string) string {
+	label = normalizeLabel(label)
+	if alias := normalizeLabel(c.Aliases[label]); alias != "" {
+		return alias
+	}
+	return label
+}
+
+func (c LabelsConfig) canonicalAll(labels []string) []string {
+	seen := make(map[string]struct{}, len(labels))
+	out := make([]string, 0, len(labels))
+	for _, label := range labels {
+		label = c.canonical(label)
+		if _, ok := seen[label]; ok || label == "" {
+			continue
+		}
+		seen[label] = struct{}{}
+		out = append(out, label)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (c LabelsConfig) groupNames() []string {
+	names := make([]string, 0, len(c.Groups))
+	for name := range c.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c LabelsConfig) problems() []string {
+	var problems []string
+	for from, to := range c.Aliases {
+		if normalizeLabel(from) == "" || normalizeLabel(to) == "" {
+			problems = append(problems, fmt.Sprintf("labels.aliases: %q -> %q must name both labels", from, to))
+		}
+	}
+	for _, name := range c.groupNames() {
+		if sanitizeID(name) == "" {
+			problems = append(problems, fmt.Sprintf("labels.groups: %q is not a usable group name", name))
+		}
+		if len(c.canonicalAll(c.Groups[name])) == 0 {
+			problems = append(problems, fmt.Sprintf("labels.groups[%q] has no labels", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (a *App) runtimeLabels(runtime *cameraRuntime) []string {
+	if runtime == nil || len(runtime.Labels) == 0 {
+		return a.config.Labels.canonicalAll(defaultLabels)
+	}
+	labels := make([]string, 0, len(runtime.Labels))
+	for label := range runtime.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// groupEntities aggregates the member labels of each configured group.
+func (a *App) groupEntities(camera string, runtime *cameraRuntime) []domain.Entity {
+	var entities []domain.Entity
+	for _, name := range a.config.Labels.groupNames() {
+		id := "group-" + sanitizeID(name)
+		title := strings.Title(name)
+
+		count, active := 0, 0
+		occupied := false
+		var last *Event
+		if runtime != nil {
+			for _, label := range a.config.Labels.canonicalAll(a.config.Labels.Groups[name]) {
+				item, ok := runtime.ByLabel[label]
+				if !ok {
+					continue
+				}
+				count += item.Count
+				active += len(item.Active)
+				occupied = occupied || item.Occupied
+				if item.LastEvent != nil && (last == nil || item.LastEvent.StartTime > last.StartTime) {
+					last = item.LastEvent
+				}
+			}
+		}
+
+		event := EventSensorState{Camera: camera, Label: name}
+		if last != nil {
+			event.LastEventID = last.ID
+			event.HasSnapshot = last.HasSnapshot
+			event.HasClip = last.HasClip
+			event.EventPresent = active > 0
+			if last.StartTime > 0 {
+				event.LastEventAt = time.Unix(int64(last.StartTime), 0).UTC().Format(time.RFC3339)
+			}
+		}
+		occupancy := occupancyLabel(occupied)
+
+		entities = append(entities,
+			domain.Entity{
+				ID:       id + "-event",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_event_sensor",
+				Name:     title + " Events",
+				State:    event,
+			},
+			domain.Entity{
+				ID:       id + "-count",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_status_sensor",
+				Name:     title + " Count",
+				State: StatusSensorState{
+					Value:     fmt.Sprintf("%d objects", count),
+					Count:     count,
+					Available: true,
+				},
+			},
+			domain.Entity{
+				ID:       id + "-active-count",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_status_sensor",
+				Name:     title + " Active Count",
+				State: StatusSensorState{
+					Value:       fmt.Sprintf("%d objects", active),
+					ActiveCount: active,
+					Available:   true,
+				},
+			},
+			domain.Entity{
+				ID:       id + "-occupancy",
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "frigate_status_sensor",
+				Name:     title + " Occupancy",
+				State: StatusSensorState{
+					Value:     occupancy,
+					Occupancy: occupancy,
+					Available: true,
+				},
+			},
+		)
+	}
+	return entities
+}
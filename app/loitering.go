@@ -0,0 +1,170 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// LoiteringEvent is published on "<loitering entity key>.event.loitering"
+// when an object has stayed in a zone for the zone's loitering_time.
+type LoiteringEvent struct {
+	Camera          string `json:"camera"`
+	Zone            string `json:"zone"`
+	Label           string `json:"label"`
+	EventID         string `json:"event_id"`
+	DurationSeconds int    `json:"duration_seconds"`
+	MaxSeverity     string `json:"max_severity,omitempty"`
+}
+
+// loiterEntry is an object inside a zone that has a loitering_time. Entries
+// are persisted with the runtime, so a restart neither resets the time an
+// object has stayed nor announces it again.
+type loiterEntry struct {
+	Label       string    `json:"label"`
+	Entered     time.Time `json:"entered"`
+	MaxSeverity string    `json:"max_severity,omitempty"`
+	Notified    bool      `json:"notified,omitempty"`
+}
+
+func loiteringEntityID(zone string) string {
+	return "loitering-" + sanitizeID(zone)
+}
+
+// trackLoitering records which loitering zones an event is currently in.
+func (r *cameraRuntime) trackLoitering(zones map[string]Zone, label string, event Event, ended bool, now time.Time) {
+	for name, zone := range zones {
+		if zone.LoiteringTime <= 0 {
+			continue
+		}
+		entries := r.Loiter[name]
+		if ended || !slices.Contains(event.CurrentZones, name) {
+			delete(entries, event.ID)
+			continue
+		}
+		if entries == nil {
+			if r.Loiter == nil {
+				r.Loiter = make(map[string]map[string]*loiterEntry)
+			}
+			entries = make(map[string]*loiterEntry)
+			r.Loiter[name] = entries
+		}
+		entry, ok := entries[event.ID]
+		if !ok {
+			entry = &loiterEntry{Label: label, Entered: now}
+			entries[event.ID] = entry
+		}
+		if event.MaxSeverity != "" {
+			entry.MaxSeverity = event.MaxSeverity
+		}
+	}
+}
+
+func (r *cameraRuntime) forgetLoitering(eventID string) {
+	for _, entries := range r.Loiter {
+		delete(entries, eventID)
+	}
+}
+
+// dueLoiteringLocked marks the objects that just reached their zone's
+// loitering_time and returns the events to publish. Callers hold a.mu.
+func (a *App) dueLoiteringLocked(camera string, runtime *cameraRuntime, now time.Time) []LoiteringEvent {
+	zones := a.cameras[camera].Zones
+	var due []LoiteringEvent
+	for zone, entries := range runtime.Loiter {
+		limit := time.Duration(zones[zone].LoiteringTime) * time.Second
+		if limit <= 0 {
+			delete(runtime.Loiter, zone)
+			continue
+		}
+		for id, entry := range entries {
+			stayed := now.Sub(entry.Entered)
+			if entry.Notified || stayed < limit {
+				continue
+			}
+			entry.Notified = true
+			due = append(due, LoiteringEvent{
+				Camera:          camera,
+				Zone:            zone,
+				Label:           entry.Label,
+				EventID:         id,
+				DurationSeconds: int(stayed / time.Second),
+				MaxSeverity:     entry.MaxSeverity,
+			})
+		}
+	}
+	return due
+}
+
+func (a *App) refreshLoitering() {
+	now := a.now()
+	var due []LoiteringEvent
+	a.mu.Lock()
+	for camera, runtime := range a.runtime {
+		due = append(due, a.dueLoiteringLocked(camera, runtime, now)...)
+	}
+	a.mu.Unlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].EventID < due[j].EventID })
+
+	changed := make(map[string]struct{})
+	for _, event := range due {
+		changed[event.Camera] = struct{}{}
+		a.publishLoitering(event)
+	}
+	for camera := range changed {
+		a.persistRuntime(camera)
+		if err := a.syncRuntimeEntities(camera); err != nil {
+			log.Printf("plugin-frigate: %sfailed to sync loitering of %s: %v", a.logPrefix(), camera, err)
+		}
+	}
+}
+
+func (a *App) publishLoitering(event LoiteringEvent) {
+	key := domain.EntityKey{Plugin: PluginID, DeviceID: a.deviceID(event.Camera), ID: loiteringEntityID(event.Zone)}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to encode loitering event: %v", err)
+		return
+	}
+	log.Printf("plugin-frigate: %s%s %s loitering in %s on %s for %ds",
+		a.logPrefix(), event.Label, event.EventID, event.Zone, event.Camera, event.DurationSeconds)
+	if err := a.msg.Publish(key.Key()+".event.loitering", data); err != nil {
+		log.Printf("plugin-frigate: failed to publish loitering event for %s: %v", key.Key(), err)
+	}
+}
+
+// loiteringEntities has one binary sensor per zone with a loitering_time,
+// on while an object in the zone has stayed longer than that.
+func (a *App) loiteringEntities(camera string, zones map[string]Zone, runtime *cameraRuntime) []domain.Entity {
+	names := make([]string, 0, len(zones))
+	for name, zone := range zones {
+		if zone.LoiteringTime > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entities := make([]domain.Entity, 0, len(names))
+	for _, name := range names {
+		on := false
+		if runtime != nil {
+			for _, entry := range runtime.Loiter[name] {
+				on = on || entry.Notified
+			}
+		}
+		entities = append(entities, domain.Entity{
+			ID:       loiteringEntityID(name),
+			Plugin:   PluginID,
+			DeviceID: a.deviceID(camera),
+			Type:     "binary_sensor",
+			Name:     strings.Title(strings.ReplaceAll(name, "_", " ")) + " Loitering",
+			State:    domain.BinarySensor{On: on, DeviceClass: "occupancy"},
+		})
+	}
+	return entities
+}
@@ -0,0 +1,389 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMediaURLTTL    = time.Hour
+	defaultMediaMaxAge    = 24 * time.Hour
+	defaultMediaMaxBytes  = 256 << 20
+	defaultMediaLatestTTL = 5 * time.Second
+)
+
+// MediaConfig enables the local media proxy. When Listen is empty the
+// plugin hands out Frigate URLs directly.
+type MediaConfig struct {
+	Listen           string `json:"listen,omitempty"`
+	PublicURL        string `json:"public_url,omitempty"`
+	CacheDir         string `json:"cache_dir,omitempty"`
+	MaxBytes         int64  `json:"max_bytes,omitempty"`
+	MaxAgeSeconds    int    `json:"max_age_seconds,omitempty"`
+	LatestTTLSeconds int    `json:"latest_ttl_seconds,omitempty"`
+	URLTTLSeconds    int    `json:"url_ttl_seconds,omitempty"`
+	Secret           string `json:"secret,omitempty"`
+	SecretFile       string `json:"secret_file,omitempty"`
+}
+
+func (c MediaConfig) urlTTL() time.Duration {
+	if c.URLTTLSeconds > 0 {
+		return time.Duration(c.URLTTLSeconds) * time.Second
+	}
+	return defaultMediaURLTTL
+}
+
+func (c MediaConfig) maxAge() time.Duration {
+	if c.MaxAgeSeconds > 0 {
+		return time.Duration(c.MaxAgeSeconds) * time.Second
+	}
+	return defaultMediaMaxAge
+}
+
+func (c MediaConfig) latestTTL() time.Duration {
+	if c.LatestTTLSeconds > 0 {
+		return time.Duration(c.LatestTTLSeconds) * time.Second
+	}
+	return defaultMediaLatestTTL
+}
+
+func (c MediaConfig) maxBytes() int64 {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+	return defaultMediaMaxBytes
+}
+
+// mediaFetcher downloads a proxied path ("<device>/latest.jpg" or
+// "<device>/events/<id>/<file>") from Frigate.
+type mediaFetcher func(ctx context.Context, deviceID, file, eventID string) ([]byte, error)
+
+// mediaService serves Frigate snapshots from a disk cache under signed,
+// expiring URLs so clients never need Frigate's address or credentials.
+type mediaService struct {
+	config    MediaConfig
+	publicURL string
+	secret    []byte
+	cacheDir  string
+	fetch     mediaFetcher
+	now       func() time.Time
+	server    *http.Server
+	mu        sync.Mutex
+}
+
+func newMediaService(config MediaConfig, fetch mediaFetcher) (*mediaService, error) {
+	secret := []byte(config.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("media secret: %w", err)
+		}
+	}
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), PluginID+"-media")
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("media cache dir: %w", err)
+	}
+	return &mediaService{
+		config:   config,
+		secret:   secret,
+		cacheDir: cacheDir,
+		fetch:    fetch,
+		now:      time.Now,
+	}, nil
+}
+
+// start listens on config.Listen. PublicURL defaults to the bound address.
+func (m *mediaService) start() error {
+	listener, err := net.Listen("tcp", m.config.Listen)
+	if err != nil {
+		return fmt.Errorf("media listen: %w", err)
+	}
+	m.publicURL = strings.TrimRight(m.config.PublicURL, "/")
+	if m.publicURL == "" {
+		m.publicURL = "http://" + listener.Addr().String()
+	}
+	m.server = &http.Server{Handler: m, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("plugin-frigate: media server error: %v", err)
+		}
+	}()
+	m.prune()
+	log.Printf("plugin-frigate: media proxy listening on %s", listener.Addr())
+	return nil
+}
+
+func (m *mediaService) stop() {
+	if m.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.server.Shutdown(ctx)
+}
+
+// signedURL returns the public URL for path ("/media/..."). The expiry is
+// rounded up to the next URL TTL boundary so that entity state only changes
+// once per TTL instead of on every sync.
+func (m *mediaService) signedURL(path string) string {
+	ttl := int64(m.config.urlTTL() / time.Second)
+	exp := (m.now().Unix()/ttl + 2) * ttl
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	return m.publicURL + escaped + "?exp=" + strconv.FormatInt(exp, 10) + "&sig=" + m.sign(path, exp)
+}
+
+func (m *mediaService) sign(path string, exp int64) string {
+	mac := hmac.New(sha256.New, m.secret)
+	fmt.Fprintf(mac, "%s\n%d", path, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *mediaService) verify(path, expParam, sig string) bool {
+	exp, err := strconv.ParseInt(expParam, 10, 64)
+	if err != nil || m.now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(m.sign(path, exp)))
+}
+
+func (m *mediaService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if !m.verify(r.URL.Path, query.Get("exp"), query.Get("sig")) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+	if name, ok := strings.CutPrefix(r.URL.Path, "/media/talkback/"); ok {
+		m.serveTalkback(w, r, name)
+		return
+	}
+
+	device, file, eventID, ok := parseMediaPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ttl := m.config.maxAge()
+	if eventID == "" {
+		ttl = m.config.latestTTL()
+	}
+	data, err := m.cached(r.Context(), r.URL.Path, ttl, func(ctx context.Context) ([]byte, error) {
+		return m.fetch(ctx, device, file, eventID)
+	})
+	if err != nil {
+		log.Printf("plugin-frigate: media fetch %s: %v", r.URL.Path, err)
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(ttl/time.Second)))
+	w.Write(data)
+}
+
+// parseMediaPath splits /media/<device>/latest.jpg and
+// /media/<device>/events/<id>/<file>.
+func parseMediaPath(p string) (device, file, eventID string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(p, "/media/"), "/")
+	switch {
+	case len(parts) == 2 && parts[1] == "latest.jpg":
+		return parts[0], parts[1], "", parts[0] != ""
+	case len(parts) == 4 && parts[1] == "events" && (parts[3] == "snapshot.jpg" || parts[3] == "thumbnail.jpg"):
+		return parts[0], parts[3], parts[2], parts[0] != "" && parts[2] != ""
+	}
+	return "", "", "", false
+}
+
+// cached returns the cached body for key if it is younger than ttl,
+// otherwise it fetches, stores and prunes the cache.
+func (m *mediaService) cached(ctx context.Context, key string, ttl time.Duration, fetch func(context.Context) ([]byte, error)) ([]byte, error) {
+	sum := sha256.Sum256([]byte(key))
+	file := filepath.Join(m.cacheDir, hex.EncodeToString(sum[:]))
+
+	if info, err := os.Stat(file); err == nil && m.now().Sub(info.ModTime()) < ttl {
+		if data, err := os.ReadFile(file); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		log.Printf("plugin-frigate: media cache write: %v", err)
+		return data, nil
+	}
+	m.pruneLocked()
+	return data, nil
+}
+
+func (m *mediaService) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+}
+
+// pruneLocked drops cache files older than the max age, then the oldest
+// files until the cache fits in max bytes.
+func (m *mediaService) pruneLocked() {
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		return
+	}
+
+	type cachedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]cachedFile, 0, len(entries))
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(m.cacheDir, entry.Name())
+		if m.now().Sub(info.ModTime()) > m.config.maxAge() {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= m.config.maxBytes() {
+			break
+		}
+		os.Remove(f.path)
+		total -= f.size
+	}
+}
+
+func (c *FrigateClient) GetEventMedia(ctx context.Context, eventID, file, query string) ([]byte, error) {
+	resp, err := c.get(ctx, eventMediaPath(eventID, file)+query)
+	if err != nil {
+		return nil, fmt.Errorf("get event %s: %w", file, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get event %s: HTTP %d: %s", file, resp.StatusCode, string(body))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// DownloadEventMedia streams an event file into path and returns its size.
+// It is written to a temporary file first, so path only ever holds a
+// complete download. Only ctx bounds the transfer: the client timeout is
+// meant for API calls and would cut off long clips.
+func (c *FrigateClient) DownloadEventMedia(ctx context.Context, eventID, file, path string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+eventMediaPath(eventID, file), nil)
+	if err != nil {
+		return 0, fmt.Errorf("get event %s: %w", file, err)
+	}
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := *c.HTTPClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("get event %s: %w", file, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("get event %s: HTTP %d: %s", file, resp.StatusCode, string(body))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("write event %s: %w", file, err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("write event %s: %w", file, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("write event %s: %w", file, err)
+	}
+	return n, nil
+}
+
+// fetchMedia resolves proxied media paths against the Frigate instance
+// that owns the device.
+func (a *App) fetchMedia(ctx context.Context, deviceID, file, eventID string) ([]byte, error) {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+
+	inst := a.instanceForDevice(deviceID)
+	if inst == nil || inst.client == nil {
+		return nil, fmt.Errorf("unknown device %s", deviceID)
+	}
+	if eventID == "" {
+		return inst.client.GetSnapshot(ctx, inst.cameraForDevice(deviceID))
+	}
+	query := ""
+	if file == "snapshot.jpg" {
+		query = inst.config.Snapshot.query()
+	}
+	return inst.client.GetEventMedia(ctx, eventID, file, query)
+}
+
+// imageURL returns the URL entities carry for a Frigate image: a signed
+// proxy URL when the media service runs, the Frigate API URL otherwise.
+func (a *App) imageURL(camera, file, eventID string) string {
+	if a.media != nil {
+		p := "/media/" + a.deviceID(camera) + "/" + file
+		if eventID != "" {
+			p = "/media/" + a.deviceID(camera) + "/events/" + eventID + "/" + file
+		}
+		return a.media.signedURL(p)
+	}
+	if eventID == "" {
+		return a.apiURL(fmt.Sprintf("/api/%s/%s", camera, file))
+	}
+	query := ""
+	if file == "snapshot.jpg" {
+		query = a.config.Snapshot.query()
+	}
+	return a.apiURL(eventMediaPath(eventID, file) + query)
+}
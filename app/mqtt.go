@@ -18,8 +18,13 @@ type MQTTEventPayload struct {
 }
 
 // HandleMQTTEvent processes a real-time event from Frigate's MQTT stream.
-// It deduplicates updates and modifies the relevant camera state.
+// It deduplicates updates and modifies the relevant camera state. A config
+// reload in progress finishes first, since it replaces the config, clients
+// and archive an MQTT connection it keeps reads.
 func (a *App) HandleMQTTEvent(payload []byte) error {
+	a.reloadMu.RLock()
+	defer a.reloadMu.RUnlock()
+
 	var mqttEvent MQTTEventPayload
 	if err := json.Unmarshal(payload, &mqttEvent); err != nil {
 		return fmt.Errorf("failed to unmarshal MQTT event: %w", err)
@@ -27,14 +32,26 @@ func (a *App) HandleMQTTEvent(payload []byte) error {
 
 	event := mqttEvent.After
 
-	if event.Camera == "" {
+	if event.Camera == "" || !a.config.Cameras.includes(event.Camera) {
 		return nil
 	}
 
 	log.Printf("plugin-frigate: mqtt received %s event %s for %s", mqttEvent.Type, event.ID, event.Camera)
 
-	a.applyMQTTEvent(mqttEvent.Type, event)
-	return a.syncRuntimeEntities(event.Camera)
+	speeding := a.applyMQTTEvent(mqttEvent.Type, event)
+	if mqttEvent.Type == "end" {
+		a.maybeArchive(event)
+	}
+	if camera := strings.TrimSpace(event.Camera); mqttEvent.Type == "new" || mqttEvent.Type == "end" || len(speeding) > 0 {
+		a.persistRuntime(camera)
+	} else {
+		a.markDirty(camera)
+	}
+	err := a.syncRuntimeEntities(event.Camera)
+	for _, s := range speeding {
+		a.publishSpeeding(s)
+	}
+	return err
 }
 
 // SetStorage is a helper for unit testing to inject the mock store
@@ -42,65 +59,78 @@ func (a *App) SetStorage(s storage.Storage) {
 	a.store = s
 }
 
-func (a *App) applyMQTTEvent(kind string, event Event) {
+func (a *App) applyMQTTEvent(kind string, event Event) []SpeedingEvent {
 	camera := strings.TrimSpace(event.Camera)
-	label := strings.ToLower(strings.TrimSpace(event.Label))
+	label := a.config.Labels.canonical(event.Label)
 	if camera == "" || label == "" {
-		return
+		return nil
 	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.runtime == nil {
-		a.runtime = make(map[string]*cameraRuntime)
-	}
-	runtime, ok := a.runtime[camera]
-	if !ok {
-		runtime = &cameraRuntime{
-			Labels:  make(map[string]struct{}),
-			ByLabel: make(map[string]*labelRuntime),
-		}
-		a.runtime[camera] = runtime
-	}
+	runtime := a.cameraRuntimeLocked(camera)
 	item := runtime.label(label)
 
+	now := a.now()
+	var previous *Event
+	if active, ok := item.Active[event.ID]; ok {
+		previous = &active
+	}
+	runtime.countZones(previous, event, now)
+
 	switch kind {
 	case "new":
 		if _, ok := item.Active[event.ID]; !ok {
 			item.Count++
+			item.Windows.add(now)
 		}
 		if event.EndTime == 0 {
-			item.Active[event.ID] = event
+			item.setActive(event, now)
 		}
 	case "update":
 		if _, ok := item.Active[event.ID]; !ok && event.EndTime == 0 {
 			item.Count++
+			item.Windows.add(now)
 		}
 		if event.EndTime == 0 {
-			item.Active[event.ID] = event
+			item.setActive(event, now)
 		} else {
-			delete(item.Active, event.ID)
+			item.clearActive(event.ID)
 		}
 	case "end":
-		delete(item.Active, event.ID)
+		item.clearActive(event.ID)
 	default:
 		if event.EndTime == 0 {
-			item.Active[event.ID] = event
+			item.setActive(event, now)
 		}
 	}
 
+	runtime.recordLast(item, event)
+	ended := kind == "end" || event.EndTime != 0
+	runtime.trackLoitering(a.cameras[camera].Zones, label, event, ended, now)
+	speeding := a.trackSpeedLocked(camera, runtime, label, event, now)
+	if ended {
+		runtime.forgetSpeeding(event.ID)
+	}
+	a.updateOccupancyLocked(camera, runtime, now)
+	return speeding
+}
+
+// recordLast keeps the newest event as the last event of the label and of
+// the camera.
+func (r *cameraRuntime) recordLast(item *labelRuntime, event Event) {
 	if item.LastEvent == nil || event.StartTime > item.LastEvent.StartTime || event.ID == item.LastEvent.ID {
 		e := event
 		item.LastEvent = &e
 	}
-	if runtime.LastEvent == nil || event.StartTime > runtime.LastEvent.StartTime || event.ID == runtime.LastEvent.ID {
+	if r.LastEvent == nil || event.StartTime > r.LastEvent.StartTime || event.ID == r.LastEvent.ID {
 		e := event
-		runtime.LastEvent = &e
+		r.LastEvent = &e
 	}
 }
 
 func (a *App) syncRuntimeEntities(cameraID string) error {
-	cameraKey := domain.EntityKey{Plugin: PluginID, DeviceID: cameraID, ID: "camera-state"}
+	cameraKey := domain.EntityKey{Plugin: PluginID, DeviceID: a.deviceID(cameraID), ID: "camera-state"}
 	raw, err := a.store.Get(cameraKey)
 	if err != nil {
 		return fmt.Errorf("get camera %s: %w", cameraID, err)
@@ -123,12 +153,18 @@ func (a *App) syncRuntimeEntities(cameraID string) error {
 		return fmt.Errorf("save camera %s: %w", cameraID, err)
 	}
 
-	for _, entity := range a.eventEntities(cameraID, runtime) {
-		if _, err := a.saveEntityIfChanged(entity); err != nil {
-			return fmt.Errorf("save runtime entity %s: %w", entity.Key(), err)
-		}
-	}
-	for _, entity := range a.summaryEntities(cameraID, runtime) {
+	entities := append(a.eventEntities(cameraID, runtime), a.eventMediaEntities(cameraID, runtime)...)
+	entities = append(entities, a.summaryEntities(cameraID, runtime)...)
+	entities = append(entities, a.groupEntities(cameraID, runtime)...)
+	entities = append(entities, a.counterEntities(cameraID, runtime)...)
+	entities = append(entities, a.objectEntities(cameraID, runtime)...)
+	a.mu.Lock()
+	zones := a.cameras[cameraID].Zones
+	a.mu.Unlock()
+	entities = append(entities, a.loiteringEntities(cameraID, zones, runtime)...)
+	entities = append(entities, a.speedEntities(cameraID, zones, runtime)...)
+	entities = append(entities, a.reapedEntity(cameraID, runtime))
+	for _, entity := range a.allowedEntities(entities) {
 		if _, err := a.saveEntityIfChanged(entity); err != nil {
 			return fmt.Errorf("save runtime entity %s: %w", entity.Key(), err)
 		}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+const runtimeTick = time.Second
+
+// OccupancyRules decide which active events make a label occupied and how
+// quickly occupancy follows them. OnDelaySeconds is how long qualifying
+// events must be present before "Detected", ClearDelaySeconds how long
+// they must be gone before "Clear". Events below MinScore (top score, or
+// score before Frigate reports one) or MinArea pixels never qualify, and
+// with IgnoreStationary neither do stationary objects such as parked cars,
+// unless they arrived within the last RecentlyArrivedSeconds. Unset fields
+// are inherited, so an explicit zero overrides an inherited value.
+type OccupancyRules struct {
+	OnDelaySeconds         *int     `json:"on_delay_seconds,omitempty"`
+	ClearDelaySeconds      *int     `json:"clear_delay_seconds,omitempty"`
+	MinScore               *float64 `json:"min_score,omitempty"`
+	MinArea                *int     `json:"min_area,omitempty"`
+	IgnoreStationary       *bool    `json:"ignore_stationary,omitempty"`
+	RecentlyArrivedSeconds *int     `json:"recently_arrived_seconds,omitempty"`
+}
+
+// OccupancyConfig holds the default rules, overridden per label, per
+// camera and per label of a camera, in that order. Labels are named after
+// aliasing.
+type OccupancyConfig struct {
+	OccupancyRules
+	Labels  map[string]OccupancyRules  `json:"labels,omitempty"`
+	Cameras map[string]CameraOccupancy `json:"cameras,omitempty"`
+}
+
+// CameraOccupancy overrides the occupancy rules of one Frigate camera.
+type CameraOccupancy struct {
+	OccupancyRules
+	Labels map[string]OccupancyRules `json:"labels,omitempty"`
+}
+
+// over returns r with every field that o sets replaced.
+func (r OccupancyRules) over(o OccupancyRules) OccupancyRules {
+	if o.OnDelaySeconds != nil {
+		r.OnDelaySeconds = o.OnDelaySeconds
+	}
+	if o.ClearDelaySeconds != nil {
+		r.ClearDelaySeconds = o.ClearDelaySeconds
+	}
+	if o.MinScore != nil {
+		r.MinScore = o.MinScore
+	}
+	if o.MinArea != nil {
+		r.MinArea = o.MinArea
+	}
+	if o.IgnoreStationary != nil {
+		r.IgnoreStationary = o.IgnoreStationary
+	}
+	if o.RecentlyArrivedSeconds != nil {
+		r.RecentlyArrivedSeconds = o.RecentlyArrivedSeconds
+	}
+	return r
+}
+
+func (c OccupancyConfig) rules(camera, label string) OccupancyRules {
+	rules := c.OccupancyRules.over(c.Labels[label])
+	cam := c.Cameras[camera]
+	return rules.over(cam.OccupancyRules).over(cam.Labels[label])
+}
+
+func (r OccupancyRules) qualifies(event Event, now time.Time) bool {
+	score := event.TopScore
+	if score == 0 {
+		score = event.Score
+	}
+	if r.MinScore != nil && *r.MinScore > 0 && score < *r.MinScore {
+		return false
+	}
+	if r.MinArea != nil && *r.MinArea > 0 && event.Area < *r.MinArea {
+		return false
+	}
+	if r.IgnoreStationary != nil && *r.IgnoreStationary && event.Stationary {
+		recent := seconds(r.RecentlyArrivedSeconds)
+		if recent <= 0 {
+			return false
+		}
+		arrived := time.Unix(int64(event.StartTime), 0)
+		return now.Sub(arrived) < recent
+	}
+	return true
+}
+
+// seconds converts an optional number of seconds, treating unset as zero.
+func seconds(n *int) time.Duration {
+	if n == nil {
+		return 0
+	}
+	return time.Duration(*n) * time.Second
+}
+
+func (r OccupancyRules) problems(scope string) []string {
+	var problems []string
+	if seconds(r.OnDelaySeconds) < 0 || seconds(r.ClearDelaySeconds) < 0 || seconds(r.RecentlyArrivedSeconds) < 0 {
+		problems = append(problems, fmt.Sprintf("%s: delays must not be negative", scope))
+	}
+	if r.MinScore != nil && (*r.MinScore < 0 || *r.MinScore > 1) {
+		problems = append(problems, fmt.Sprintf("%s: min_score %v is not between 0 and 1", scope, *r.MinScore))
+	}
+	if r.MinArea != nil && *r.MinArea < 0 {
+		problems = append(problems, fmt.Sprintf("%s: min_area must not be negative", scope))
+	}
+	return problems
+}
+
+func (c OccupancyConfig) problems() []string {
+	problems := c.OccupancyRules.problems("occupancy")
+	for label, rules := range c.Labels {
+		problems = append(problems, rules.problems(fmt.Sprintf("occupancy.labels[%q]", label))...)
+	}
+	for camera, cam := range c.Cameras {
+		scope := fmt.Sprintf("occupancy.cameras[%q]", camera)
+		problems = append(problems, cam.OccupancyRules.problems(scope)...)
+		for label, rules := range cam.Labels {
+			problems = append(problems, rules.problems(fmt.Sprintf("%s.labels[%q]", scope, label))...)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// updateOccupancyLocked moves each label's debounced occupancy towards its
+// qualifying active events once the on or clear delay has passed, and
+// reports whether any label changed. Callers hold a.mu.
+func (a *App) updateOccupancyLocked(camera string, runtime *cameraRuntime, now time.Time) bool {
+	changed := false
+	for label, item := range runtime.ByLabel {
+		rules := a.config.Occupancy.rules(camera, label)
+		detected := false
+		for _, event := range item.Active {
+			if rules.qualifies(event, now) {
+				detected = true
+				break
+			}
+		}
+		if detected == item.Occupied {
+			item.Pending = time.Time{}
+			continue
+		}
+		delay := seconds(rules.ClearDelaySeconds)
+		if detected {
+			delay = seconds(rules.OnDelaySeconds)
+		}
+		if item.Pending.IsZero() {
+			item.Pending = now
+		}
+		if now.Sub(item.Pending) < delay {
+			continue
+		}
+		item.Occupied = detected
+		item.Pending = time.Time{}
+		changed = true
+	}
+	return changed
+}
+
+// ObjectCountsState splits the active objects of a label by whether
+// Frigate considers them stationary.
+type ObjectCountsState struct {
+	Value      string `json:"value"`
+	Moving     int    `json:"moving"`
+	Stationary int    `json:"stationary"`
+}
+
+// objectEntities exposes moving and stationary counts per label.
+func (a *App) objectEntities(camera string, runtime *cameraRuntime) []domain.Entity {
+	labels := a.runtimeLabels(runtime)
+	entities := make([]domain.Entity, 0, len(labels))
+	for _, label := range labels {
+		var state ObjectCountsState
+		if runtime != nil {
+			if item := runtime.ByLabel[label]; item != nil {
+				for _, event := range item.Active {
+					if event.Stationary {
+						state.Stationary++
+					} else {
+						state.Moving++
+					}
+				}
+			}
+		}
+		state.Value = fmt.Sprintf("%d moving, %d stationary", state.Moving, state.Stationary)
+		entities = append(entities, domain.Entity{
+			ID:       "objects-" + sanitizeID(label),
+			Plugin:   PluginID,
+			DeviceID: a.deviceID(camera),
+			Type:     "frigate_object_counts",
+			Name:     strings.Title(label) + " Objects",
+			State:    state,
+		})
+	}
+	return entities
+}
+
+func occupancyLabel(occupied bool) string {
+	if occupied {
+		return "Detected"
+	}
+	return "Clear"
+}
+
+// watchRuntime applies pending occupancy delays, loitering times and
+// counter windows between events, and stores runtime that MQTT updates
+// changed.
+func (a *App) watchRuntime(ctx context.Context) {
+	ticker := a.newTicker(runtimeTick)
+	defer ticker.Stop()
+	persist := a.newTicker(runtimePersistInterval)
+	defer persist.Stop()
+
+	counted := a.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.refreshOccupancy()
+			a.refreshLoitering()
+			counted = a.refreshCounters(counted)
+		case <-persist.C:
+			a.flushRuntime()
+		}
+	}
+}
+
+func (a *App) refreshOccupancy() {
+	now := a.now()
+	var changed []string
+	a.mu.Lock()
+	for camera, runtime := range a.runtime {
+		if a.updateOccupancyLocked(camera, runtime, now) {
+			changed = append(changed, camera)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, camera := range changed {
+		a.persistRuntime(camera)
+		if err := a.syncRuntimeEntities(camera); err != nil {
+			log.Printf("plugin-frigate: %sfailed to sync occupancy of %s: %v", a.logPrefix(), camera, err)
+		}
+	}
+}
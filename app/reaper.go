@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+const (
+	defaultStaleMaxAge  = 10 * time.Minute
+	defaultReapInterval = time.Minute
+	staleCheckTimeout   = 30 * time.Second
+)
+
+var errEventNotFound = errors.New("event not found")
+
+// StaleEventsConfig controls the reaper that expires active events whose
+// "end" message was lost. An event without an MQTT update for MaxAgeSeconds
+// is looked up in Frigate and dropped if Frigate ended it or no longer
+// knows it.
+type StaleEventsConfig struct {
+	MaxAgeSeconds   int `json:"max_age_seconds,omitempty"`
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+func (c StaleEventsConfig) maxAge() time.Duration {
+	if c.MaxAgeSeconds > 0 {
+		return time.Duration(c.MaxAgeSeconds) * time.Second
+	}
+	return defaultStaleMaxAge
+}
+
+func (c StaleEventsConfig) interval() time.Duration {
+	if c.IntervalSeconds > 0 {
+		return time.Duration(c.IntervalSeconds) * time.Second
+	}
+	return defaultReapInterval
+}
+
+func (a *App) reapStaleEvents(ctx context.Context) {
+	ticker := a.newTicker(a.config.StaleEvents.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.reapOnce(ctx)
+		}
+	}
+}
+
+type staleEvent struct {
+	camera string
+	label  string
+	id     string
+}
+
+// reapOnce checks every active event that has not been updated within the
+// max age. Events Frigate still reports as in progress are kept and their
+// age restarts.
+func (a *App) reapOnce(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, staleCheckTimeout)
+	defer cancel()
+
+	now := a.now()
+	maxAge := a.config.StaleEvents.maxAge()
+	var stale []staleEvent
+	a.mu.Lock()
+	for camera, runtime := range a.runtime {
+		for label, item := range runtime.ByLabel {
+			for id := range item.Active {
+				if now.Sub(item.Seen[id]) >= maxAge {
+					stale = append(stale, staleEvent{camera: camera, label: label, id: id})
+				}
+			}
+		}
+	}
+	a.mu.Unlock()
+	sort.Slice(stale, func(i, j int) bool { return stale[i].id < stale[j].id })
+
+	changed := make(map[string]struct{})
+	for _, s := range stale {
+		event, err := a.client.GetEvent(ctx, s.id)
+		if err != nil && !errors.Is(err, errEventNotFound) {
+			log.Printf("plugin-frigate: %sstale event check for %s failed: %v", a.logPrefix(), s.id, err)
+			continue
+		}
+
+		a.mu.Lock()
+		runtime, item := a.activeLabelLocked(s.camera, s.label, s.id)
+		active := item != nil
+		if active && event != nil && event.EndTime == 0 {
+			item.Seen[s.id] = now
+			active = false
+		} else if active {
+			item.clearActive(s.id)
+			runtime.forgetLoitering(s.id)
+			runtime.forgetSpeeding(s.id)
+			runtime.Reaped++
+			if event != nil {
+				runtime.recordLast(item, *event)
+			}
+			a.updateOccupancyLocked(s.camera, runtime, now)
+		}
+		a.mu.Unlock()
+		if active {
+			log.Printf("plugin-frigate: %sreaped stale %s event %s on %s", a.logPrefix(), s.label, s.id, s.camera)
+			changed[s.camera] = struct{}{}
+		}
+	}
+
+	for camera := range changed {
+		a.persistRuntime(camera)
+		if err := a.syncRuntimeEntities(camera); err != nil {
+			log.Printf("plugin-frigate: %sfailed to sync %s after reaping: %v", a.logPrefix(), camera, err)
+		}
+	}
+}
+
+// activeLabelLocked returns the runtime and label holding an active event,
+// or nils once the event or its camera is gone. Callers hold a.mu.
+func (a *App) activeLabelLocked(camera, label, id string) (*cameraRuntime, *labelRuntime) {
+	runtime, ok := a.runtime[camera]
+	if !ok {
+		return nil, nil
+	}
+	item := runtime.ByLabel[label]
+	if item == nil {
+		return nil, nil
+	}
+	if _, ok := item.Active[id]; !ok {
+		return nil, nil
+	}
+	return runtime, item
+}
+
+// reapedEntity counts the active events of a camera the reaper dropped.
+func (a *App) reapedEntity(camera string, runtime *cameraRuntime) domain.Entity {
+	reaped := 0
+	if runtime != nil {
+		reaped = runtime.Reaped
+	}
+	return domain.Entity{
+		ID:       "reaped-events",
+		Plugin:   PluginID,
+		DeviceID: a.deviceID(camera),
+		Type:     "frigate_status_sensor",
+		Name:     "Reaped Events",
+		State: StatusSensorState{
+			Value:     fmt.Sprintf("%d events", reaped),
+			Count:     reaped,
+			Available: true,
+		},
+	}
+}
+
+// GetEvent fetches one event. It returns errEventNotFound when Frigate
+// does not know the event.
+func (c *FrigateClient) GetEvent(ctx context.Context, eventID string) (*Event, error) {
+	resp, err := c.get(ctx, "/api/events/"+url.PathEscape(eventID))
+	if err != nil {
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get event %s: %w", eventID, errEventNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get event: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var event Event
+	if err := json.NewDecoder(resp.Body).Decode(&event); err != nil {
+		return nil, fmt.Errorf("decode event: %w", err)
+	}
+	return &event, nil
+}
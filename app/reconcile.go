@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+// PluginDeviceID is the device that carries plugin-wide entities such as the
+// reconcile button. The leading underscore keeps it apart from camera and
+// instance device IDs.
+const PluginDeviceID = "_plugin"
+
+// PluginReconcile runs discovery immediately. An empty Instance reconciles
+// every instance.
+type PluginReconcile struct {
+	Instance string `json:"instance,omitempty"`
+}
+
+// ReconcileDiff summarises what a reconcile changed in storage. Cameras are
+// device IDs, entities "<device>.<entity>".
+type ReconcileDiff struct {
+	CamerasAdded    []string `json:"cameras_added,omitempty"`
+	CamerasRemoved  []string `json:"cameras_removed,omitempty"`
+	CamerasChanged  []string `json:"cameras_changed,omitempty"`
+	EntitiesAdded   []string `json:"entities_added,omitempty"`
+	EntitiesRemoved []string `json:"entities_removed,omitempty"`
+	EntitiesChanged []string `json:"entities_changed,omitempty"`
+}
+
+func (d *ReconcileDiff) merge(other ReconcileDiff) {
+	d.CamerasAdded = append(d.CamerasAdded, other.CamerasAdded...)
+	d.CamerasRemoved = append(d.CamerasRemoved, other.CamerasRemoved...)
+	d.CamerasChanged = append(d.CamerasChanged, other.CamerasChanged...)
+	d.EntitiesAdded = append(d.EntitiesAdded, other.EntitiesAdded...)
+	d.EntitiesRemoved = append(d.EntitiesRemoved, other.EntitiesRemoved...)
+	d.EntitiesChanged = append(d.EntitiesChanged, other.EntitiesChanged...)
+}
+
+func (d *ReconcileDiff) sort() {
+	for _, list := range [][]string{d.CamerasAdded, d.CamerasRemoved, d.CamerasChanged, d.EntitiesAdded, d.EntitiesRemoved, d.EntitiesChanged} {
+		sort.Strings(list)
+	}
+}
+
+func (d ReconcileDiff) String() string {
+	return fmt.Sprintf("cameras +%d -%d ~%d, entities +%d -%d ~%d",
+		len(d.CamerasAdded), len(d.CamerasRemoved), len(d.CamerasChanged),
+		len(d.EntitiesAdded), len(d.EntitiesRemoved), len(d.EntitiesChanged))
+}
+
+// ReconcileResult is the reply to frigate_reconcile.
+type ReconcileResult struct {
+	OK bool `json:"ok"`
+	ReconcileDiff
+	Errors []string `json:"errors,omitempty"`
+}
+
+// reconcileInterval is the configured interval, ReconcileInterval by default.
+func (c FrigateConfig) reconcileInterval() time.Duration {
+	if c.ReconcileIntervalSeconds > 0 {
+		return time.Duration(c.ReconcileIntervalSeconds) * time.Second
+	}
+	return ReconcileInterval
+}
+
+// reconcileJitter defaults to a tenth of the interval so that instances and
+// plugin restarts do not hit Frigate in lockstep.
+func (c FrigateConfig) reconcileJitter() time.Duration {
+	if c.ReconcileJitterSeconds > 0 {
+		return time.Duration(c.ReconcileJitterSeconds) * time.Second
+	}
+	return c.reconcileInterval() / 10
+}
+
+func (c FrigateConfig) nextReconcile() time.Duration {
+	next := c.reconcileInterval()
+	if jitter := c.reconcileJitter(); jitter > 0 {
+		next += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return next
+}
+
+// parseInterval reads FRIGATE_RECONCILE_INTERVAL as a Go duration ("5m")
+// or a number of seconds.
+func parseInterval(value string) (int, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return seconds, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= time.Second {
+		return int(d / time.Second), nil
+	}
+	return 0, fmt.Errorf("%q is not a duration of at least 1s or a number of seconds", value)
+}
+
+// reconcileCameras re-runs discovery after each jittered interval.
+func (a *App) reconcileCameras(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.after(a.config.nextReconcile()):
+			if _, err := a.discoverCameras(); err != nil {
+				log.Printf("plugin-frigate: %scamera reconcile error: %v", a.logPrefix(), err)
+			}
+		}
+	}
+}
+
+// SetAfter replaces the timer that schedules reconciles, for tests.
+func (a *App) SetAfter(after func(time.Duration) <-chan time.Time) {
+	a.after = after
+	for _, inst := range a.instances {
+		inst.after = after
+	}
+}
+
+func (a *App) pluginDevice() domain.Device {
+	return domain.Device{
+		ID:     PluginDeviceID,
+		Plugin: PluginID,
+		Name:   "Frigate",
+	}
+}
+
+func (a *App) pluginEntities() []domain.Entity {
+	return []domain.Entity{
+		{
+			ID:       "reconcile",
+			Plugin:   PluginID,
+			DeviceID: PluginDeviceID,
+			Type:     "button",
+			Name:     "Reconcile Cameras",
+			Commands: []string{"frigate_reconcile"},
+			State:    domain.Button{},
+		},
+		a.diagnosticsEntity(),
+	}
+}
+
+// syncPluginDevice stores the plugin device and its entities.
+func (a *App) syncPluginDevice() {
+	if _, err := a.saveDeviceIfChanged(a.pluginDevice()); err != nil {
+		log.Printf("plugin-frigate: failed to save plugin device: %v", err)
+		return
+	}
+	for _, entity := range a.pluginEntities() {
+		if _, err := a.saveEntityIfChanged(entity); err != nil {
+			log.Printf("plugin-frigate: failed to save plugin entity %s: %v", entity.ID, err)
+		}
+	}
+}
+
+func (a *App) handlePluginCommand(addr messenger.Address, cmd any, msg *messenger.Message) {
+	switch c := cmd.(type) {
+	case PluginReconcile:
+		a.handleReconcile(c, msg)
+	default:
+		log.Printf("plugin-frigate: unknown plugin command %T for %s", cmd, addr.Key())
+	}
+}
+
+func (a *App) handleReconcile(cmd PluginReconcile, msg *messenger.Message) {
+	var result ReconcileResult
+	matched := false
+	for _, inst := range a.instances {
+		if cmd.Instance != "" && inst.name != cmd.Instance {
+			continue
+		}
+		matched = true
+		if inst.client == nil {
+			result.Errors = append(result.Errors, inst.logPrefix()+"no Frigate URL configured")
+			continue
+		}
+		diff, err := inst.discoverCameras()
+		result.merge(diff)
+		if err != nil {
+			result.Errors = append(result.Errors, inst.logPrefix()+redactError(err))
+		}
+	}
+	if !matched {
+		result.Errors = append(result.Errors, fmt.Sprintf("unknown instance %q", cmd.Instance))
+	}
+	result.sort()
+	result.OK = len(result.Errors) == 0
+	log.Printf("plugin-frigate: on-demand reconcile: %s", result.ReconcileDiff)
+	reply(msg, result)
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay coalesces the bursts of events editors produce when
+// saving a file.
+const configReloadDelay = 250 * time.Millisecond
+
+// watchConfig reloads config.json whenever it changes. The directory is
+// watched rather than the file, since editors often replace the file.
+// FRIGATE_CONFIG takes precedence over the file, so there is nothing to
+// watch when it is set.
+func (a *App) watchConfig() {
+	if os.Getenv("FRIGATE_CONFIG") != "" {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("plugin-frigate: config hot reload disabled: %v", err)
+		return
+	}
+	if err := watcher.Add("."); err != nil {
+		log.Printf("plugin-frigate: config hot reload disabled: %v", err)
+		watcher.Close()
+		return
+	}
+	a.watcher = watcher
+	go a.watchLoop(watcher)
+}
+
+func (a *App) stopWatching() {
+	a.reloadMu.Lock()
+	a.closed = true
+	a.reloadMu.Unlock()
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+}
+
+func (a *App) watchLoop(watcher *fsnotify.Watcher) {
+	var timer *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			}
+			if filepath.Base(event.Name) != configFile || !event.Has(fsnotify.Write|fsnotify.Create) {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(configReloadDelay, a.reloadFromFile)
+			} else {
+				timer.Reset(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("plugin-frigate: config watch error: %v", err)
+		}
+	}
+}
+
+func (a *App) reloadFromFile() {
+	if _, err := os.Stat(configFile); err != nil {
+		log.Printf("plugin-frigate: %s unavailable, keeping current config: %v", configFile, err)
+		return
+	}
+	if err := a.reloadConfig(); err != nil {
+		log.Printf("plugin-frigate: config reload rejected, keeping current config: %v", err)
+	}
+}
+
+// reloadConfig applies a changed config to the running plugin. Instances
+// are matched by name and reconfigured in place; new ones are started and
+// removed ones stopped, leaving their devices to removeOrphans.
+func (a *App) reloadConfig() error {
+	config, err := readConfig()
+	if err != nil {
+		a.setDiagnostics(config.source, []string{err.Error()}, true)
+		return fmt.Errorf("read config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		a.setDiagnostics(config.source, config.problems(), true)
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	if a.closed {
+		return nil
+	}
+	if reflect.DeepEqual(config, a.source) {
+		a.setDiagnostics(config.source, nil, false)
+		return nil
+	}
+	if !reflect.DeepEqual(config.Media, a.source.Media) {
+		log.Printf("plugin-frigate: media proxy changes take effect after a restart")
+		config.Media = a.source.Media
+	}
+
+	current := make(map[string]*App, len(a.instances))
+	for _, inst := range a.instances {
+		current[inst.name] = inst
+	}
+	var next []*App
+	if len(config.Instances) == 0 {
+		delete(current, "")
+		a.reconfigure(config)
+		next = []*App{a}
+	} else {
+		// Stops the orphan sweep, or the loops of a single server moving
+		// under instances, and reloads the missing counters it keeps.
+		a.stopLoops()
+		a.mu.Lock()
+		a.missing = nil
+		a.mu.Unlock()
+		a.config = config
+		for _, instConfig := range config.instanceConfigs() {
+			inst, ok := current[instConfig.Name]
+			if !ok {
+				inst = a.newInstance(instConfig)
+				inst.initInstance()
+				inst.startInstance()
+				log.Printf("plugin-frigate: %sinstance added", inst.logPrefix())
+			} else {
+				delete(current, instConfig.Name)
+				inst.reconfigure(instConfig)
+			}
+			next = append(next, inst)
+		}
+	}
+	for _, inst := range current {
+		inst.stopLoops()
+		inst.disconnectMQTT()
+		if inst.name != "" {
+			log.Printf("plugin-frigate: %sinstance removed", inst.logPrefix())
+		}
+	}
+	a.instances = next
+	a.removeOrphans()
+	a.watchOrphans()
+	a.source = config
+	setSecrets(config.secretValues())
+	a.setDiagnostics(config.source, nil, false)
+	log.Printf("plugin-frigate: reloaded %s", configFile)
+	return nil
+}
+
+// reconfigure restarts one instance with a new config. The MQTT connection
+// is kept unless its settings changed.
+func (a *App) reconfigure(config FrigateConfig) {
+	a.stopLoops()
+	if config.MQTT.TopicPrefix == "" {
+		config.MQTT.TopicPrefix = defaultMQTTTopic
+	}
+	if config.URL == "" || config.MQTT != a.config.MQTT {
+		a.disconnectMQTT()
+	}
+	if config.URL == "" {
+		a.config = config
+		return
+	}
+	a.archive = nil
+	a.config = config
+	a.initInstance()
+	a.startInstance()
+}
+
+// stopLoops cancels the reconcile, stream health and reaper loops, archive
+// downloads and the export watcher, and waits for them to return.
+func (a *App) stopLoops() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.loops.Wait()
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+const (
+	defaultRTSPPort  = 8554
+	defaultRTSPSPort = 8555
+)
+
+// RTSPConfig adds rtsp:// (and optionally rtsps://) restream entities for
+// every discovered go2rtc stream. Host defaults to the go2rtc or Frigate
+// host. Credentials are never written to entity state; clients fetch the
+// full URL with frigate_stream_url.
+type RTSPConfig struct {
+	Enabled   bool   `json:"enabled,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	RTSPS     bool   `json:"rtsps,omitempty"`
+	RTSPSPort int    `json:"rtsps_port,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+
+	UsernameFile string `json:"username_file,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+}
+
+// CameraStreamURL asks for the full URL of an RTSP stream entity, including
+// credentials. The URL is only sent in the reply.
+type CameraStreamURL struct{}
+
+type StreamURLResult struct {
+	OK     bool   `json:"ok"`
+	Camera string `json:"camera"`
+	Stream string `json:"stream,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func rtspSpecs(suffix string, rtsps bool) []streamSpec {
+	id := func(scheme string) string { return "stream-" + scheme }
+	name := ""
+	if suffix != "" {
+		id = func(scheme string) string { return restreamID(scheme, suffix) }
+		name = strings.Title(strings.ReplaceAll(suffix, "-", " ")) + " "
+	}
+	specs := []streamSpec{
+		{ID: id("rtsp"), Name: name + "RTSP Stream", Format: "rtsp", Kind: "restream", Scheme: "rtsp"},
+	}
+	if rtsps {
+		specs = append(specs, streamSpec{ID: id("rtsps"), Name: name + "RTSPS Stream", Format: "rtsps", Kind: "restream", Scheme: "rtsps"})
+	}
+	return specs
+}
+
+// streamSpecsFor lists the entities of one go2rtc stream: the HTTP specs
+// plus the RTSP restreams when they are enabled.
+func (a *App) streamSpecsFor(suffix string) []streamSpec {
+	specs := streamSpecs(suffix)
+	if a.config.RTSP.Enabled {
+		specs = append(specs, rtspSpecs(suffix, a.config.RTSP.RTSPS)...)
+	}
+	return specs
+}
+
+// streamURL builds the URL for a stream entity. RTSP URLs only carry the
+// configured credentials when withAuth is set.
+func (a *App) streamURL(spec streamSpec, stream string, withAuth bool) string {
+	if spec.Scheme == "" {
+		return a.go2rtcURL(spec.Path, stream)
+	}
+
+	port := a.config.RTSP.Port
+	if port == 0 {
+		port = defaultRTSPPort
+	}
+	if spec.Scheme == "rtsps" {
+		port = a.config.RTSP.RTSPSPort
+		if port == 0 {
+			port = defaultRTSPSPort
+		}
+	}
+
+	u := url.URL{
+		Scheme: spec.Scheme,
+		Host:   net.JoinHostPort(a.rtspHost(), strconv.Itoa(port)),
+		Path:   "/" + stream,
+	}
+	if withAuth && a.config.RTSP.Username != "" {
+		u.User = url.UserPassword(a.config.RTSP.Username, a.config.RTSP.Password)
+	}
+	return u.String()
+}
+
+func (a *App) rtspHost() string {
+	if a.config.RTSP.Host != "" {
+		return a.config.RTSP.Host
+	}
+	for _, base := range []string{a.config.Go2RTCURL, a.config.URL} {
+		if u, err := url.Parse(base); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return "localhost"
+}
+
+func (a *App) handleStreamURL(cameraID, entityID string, msg *messenger.Message) {
+	result := StreamURLResult{Camera: cameraID}
+	stream, spec, ok := a.streamForEntity(cameraID, entityID)
+	if !ok || spec.Scheme == "" {
+		result.Error = fmt.Sprintf("no RTSP stream for %s.%s", cameraID, entityID)
+		reply(msg, result)
+		return
+	}
+
+	result.OK = true
+	result.Stream = stream
+	result.URL = a.streamURL(spec, stream, true)
+	reply(msg, result)
+}
@@ -0,0 +1,348 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	storage "github.com/slidebolt/sb-storage-sdk"
+)
+
+// runtimePersistInterval bounds how long runtime changed by MQTT updates
+// stays unsaved.
+const runtimePersistInterval = 10 * time.Second
+
+// persistedRuntime is the stored form of one camera's runtime, so counters
+// and last events survive plugin restarts and upgrades.
+type persistedRuntime struct {
+	LastEvent *Event                            `json:"last_event,omitempty"`
+	Labels    map[string]persistedLabel         `json:"labels"`
+	Zones     map[string]windowCounter          `json:"zones,omitempty"`
+	Reaped    int                               `json:"reaped,omitempty"`
+	Speeds    map[string]zoneSpeed              `json:"speeds,omitempty"`
+	Loiter    map[string]map[string]loiterEntry `json:"loiter,omitempty"`
+}
+
+type persistedLabel struct {
+	Count     int                    `json:"count"`
+	LastEvent *Event                 `json:"last_event,omitempty"`
+	Active    map[string]activeEvent `json:"active,omitempty"`
+	Windows   windowCounter          `json:"windows,omitempty"`
+	Occupied  bool                   `json:"occupied,omitempty"`
+}
+
+type activeEvent struct {
+	Event Event     `json:"event"`
+	Seen  time.Time `json:"seen"`
+}
+
+func runtimeKey(deviceID string) rawKey {
+	return rawKey(PluginID + ".runtime." + deviceID)
+}
+
+func (l *labelRuntime) setActive(event Event, seen time.Time) {
+	l.Active[event.ID] = event
+	if l.Seen == nil {
+		l.Seen = make(map[string]time.Time)
+	}
+	l.Seen[event.ID] = seen
+}
+
+func (l *labelRuntime) clearActive(id string) {
+	delete(l.Active, id)
+	delete(l.Seen, id)
+}
+
+func (r *cameraRuntime) persisted() persistedRuntime {
+	p := persistedRuntime{LastEvent: r.LastEvent, Labels: make(map[string]persistedLabel, len(r.Labels)), Reaped: r.Reaped}
+	if len(r.Speeds) > 0 {
+		p.Speeds = make(map[string]zoneSpeed, len(r.Speeds))
+		for zone, speed := range r.Speeds {
+			stored := zoneSpeed{Last: speed.Last, MaxToday: speed.MaxToday, Day: speed.Day}
+			if len(speed.Speeding) > 0 {
+				stored.Speeding = make(map[string]struct{}, len(speed.Speeding))
+				for id := range speed.Speeding {
+					stored.Speeding[id] = struct{}{}
+				}
+			}
+			p.Speeds[zone] = stored
+		}
+	}
+	for zone, entries := range r.Loiter {
+		if len(entries) == 0 {
+			continue
+		}
+		if p.Loiter == nil {
+			p.Loiter = make(map[string]map[string]loiterEntry, len(r.Loiter))
+		}
+		p.Loiter[zone] = make(map[string]loiterEntry, len(entries))
+		for id, entry := range entries {
+			p.Loiter[zone][id] = *entry
+		}
+	}
+	if len(r.Zones) > 0 {
+		p.Zones = make(map[string]windowCounter, len(r.Zones))
+		for zone, counts := range r.Zones {
+			p.Zones[zone] = counts.clone()
+		}
+	}
+	for label := range r.Labels {
+		item := r.ByLabel[label]
+		if item == nil {
+			p.Labels[label] = persistedLabel{}
+			continue
+		}
+		stored := persistedLabel{
+			Count:     item.Count,
+			LastEvent: item.LastEvent,
+			Windows:   item.Windows.clone(),
+			Occupied:  item.Occupied,
+		}
+		if len(item.Active) > 0 {
+			stored.Active = make(map[string]activeEvent, len(item.Active))
+			for id, event := range item.Active {
+				stored.Active[id] = activeEvent{Event: event, Seen: item.Seen[id]}
+			}
+		}
+		p.Labels[label] = stored
+	}
+	return p
+}
+
+func (p persistedRuntime) runtime() *cameraRuntime {
+	r := &cameraRuntime{
+		Labels:    make(map[string]struct{}, len(p.Labels)),
+		ByLabel:   make(map[string]*labelRuntime, len(p.Labels)),
+		LastEvent: p.LastEvent,
+		Zones:     p.Zones,
+		Reaped:    p.Reaped,
+	}
+	for zone, speed := range p.Speeds {
+		if r.Speeds == nil {
+			r.Speeds = make(map[string]*zoneSpeed, len(p.Speeds))
+		}
+		s := speed
+		r.Speeds[zone] = &s
+	}
+	for zone, entries := range p.Loiter {
+		if r.Loiter == nil {
+			r.Loiter = make(map[string]map[string]*loiterEntry, len(p.Loiter))
+		}
+		r.Loiter[zone] = make(map[string]*loiterEntry, len(entries))
+		for id, entry := range entries {
+			e := entry
+			r.Loiter[zone][id] = &e
+		}
+	}
+	for label, stored := range p.Labels {
+		item := r.label(label)
+		item.Count = stored.Count
+		item.LastEvent = stored.LastEvent
+		item.Occupied = stored.Occupied
+		if stored.Windows != nil {
+			item.Windows = stored.Windows
+		}
+		for id, active := range stored.Active {
+			item.Active[id] = active.Event
+			item.Seen[id] = active.Seen
+		}
+	}
+	return r
+}
+
+// persistRuntime stores the runtime of one camera in plugin-internal
+// storage.
+func (a *App) persistRuntime(camera string) {
+	a.mu.Lock()
+	delete(a.dirty, camera)
+	runtime, ok := a.runtime[camera]
+	var stored persistedRuntime
+	if ok {
+		stored = runtime.persisted()
+	}
+	a.mu.Unlock()
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to encode runtime for %s: %v", camera, err)
+		return
+	}
+	if err := a.store.SetInternal(runtimeKey(a.deviceID(camera)), data); err != nil {
+		log.Printf("plugin-frigate: failed to store runtime for %s: %v", camera, err)
+	}
+}
+
+// markDirty defers storing a camera's runtime to the next flushRuntime.
+// Frigate sends several updates per second for each tracked object, so
+// only new and ended events are stored at once.
+func (a *App) markDirty(camera string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.dirty == nil {
+		a.dirty = make(map[string]struct{})
+	}
+	a.dirty[camera] = struct{}{}
+}
+
+// flushRuntime stores the runtime of every camera marked dirty.
+func (a *App) flushRuntime() {
+	a.mu.Lock()
+	cameras := make([]string, 0, len(a.dirty))
+	for camera := range a.dirty {
+		cameras = append(cameras, camera)
+	}
+	a.mu.Unlock()
+	sort.Strings(cameras)
+	for _, camera := range cameras {
+		a.persistRuntime(camera)
+	}
+}
+
+// forgetRuntime drops the runtime of a deleted camera.
+func (a *App) forgetRuntime(deviceID string) {
+	a.mu.Lock()
+	delete(a.runtime, a.cameraForDevice(deviceID))
+	a.mu.Unlock()
+	if err := a.store.DeleteInternal(runtimeKey(deviceID)); err != nil {
+		log.Printf("plugin-frigate: failed to delete runtime for %s: %v", deviceID, err)
+	}
+}
+
+// restoreRuntime loads the persisted runtime of this instance's cameras.
+// Restored active events are checked against Frigate's in-progress events:
+// events that ended while the plugin was down are dropped and events that
+// started meanwhile are counted. Cameras that already have runtime, as after
+// a config reload, are left alone.
+func (a *App) restoreRuntime(ctx context.Context) {
+	entries, err := a.store.SearchFiles(storage.Internal, PluginID+".runtime.>")
+	if err != nil {
+		log.Printf("plugin-frigate: %sfailed to load runtime: %v", a.logPrefix(), err)
+		return
+	}
+
+	restored := make(map[string]*cameraRuntime)
+	active := false
+	for _, entry := range entries {
+		device := strings.TrimPrefix(entry.Key, PluginID+".runtime.")
+		if !a.ownsDevice(device) {
+			continue
+		}
+		var stored persistedRuntime
+		if err := json.Unmarshal(entry.Data, &stored); err != nil {
+			log.Printf("plugin-frigate: %sdiscarding unreadable runtime for %s: %v", a.logPrefix(), device, err)
+			continue
+		}
+		runtime := stored.runtime()
+		for _, item := range runtime.ByLabel {
+			active = active || len(item.Active) > 0
+		}
+		restored[a.cameraForDevice(device)] = runtime
+	}
+	if len(restored) == 0 {
+		return
+	}
+
+	if active {
+		events, err := a.client.GetInProgressEvents(ctx)
+		if err != nil {
+			log.Printf("plugin-frigate: %skeeping restored active events, in-progress check failed: %v", a.logPrefix(), err)
+		} else {
+			a.reconcileActive(restored, events)
+		}
+	}
+
+	a.mu.Lock()
+	if a.runtime == nil {
+		a.runtime = make(map[string]*cameraRuntime)
+	}
+	var cameras []string
+	for camera, runtime := range restored {
+		if _, ok := a.runtime[camera]; ok {
+			continue
+		}
+		a.runtime[camera] = runtime
+		cameras = append(cameras, camera)
+	}
+	a.mu.Unlock()
+
+	for _, camera := range cameras {
+		a.persistRuntime(camera)
+	}
+	log.Printf("plugin-frigate: %srestored runtime for %d cameras", a.logPrefix(), len(cameras))
+}
+
+func (a *App) reconcileActive(restored map[string]*cameraRuntime, inProgress []Event) {
+	now := a.now()
+	current := make(map[string]struct{}, len(inProgress))
+	for _, event := range inProgress {
+		current[event.ID] = struct{}{}
+		runtime, ok := restored[event.Camera]
+		label := a.config.Labels.canonical(event.Label)
+		if !ok || label == "" || !a.config.Cameras.includes(event.Camera) {
+			continue
+		}
+		item := runtime.label(label)
+		var previous *Event
+		if active, ok := item.Active[event.ID]; ok {
+			previous = &active
+		} else {
+			item.Count++
+			item.Windows.add(now)
+		}
+		runtime.countZones(previous, event, now)
+		item.setActive(event, now)
+		runtime.recordLast(item, event)
+	}
+	for camera, runtime := range restored {
+		for _, item := range runtime.ByLabel {
+			for id := range item.Active {
+				if _, ok := current[id]; !ok {
+					item.clearActive(id)
+				}
+			}
+		}
+		for _, entries := range runtime.Loiter {
+			for id := range entries {
+				if _, ok := current[id]; !ok {
+					delete(entries, id)
+				}
+			}
+		}
+		for _, speed := range runtime.Speeds {
+			for id := range speed.Speeding {
+				if _, ok := current[id]; !ok {
+					delete(speed.Speeding, id)
+				}
+			}
+		}
+		a.updateOccupancyLocked(camera, runtime, now)
+	}
+}
+
+// GetInProgressEvents lists the events Frigate has not ended yet.
+func (c *FrigateClient) GetInProgressEvents(ctx context.Context) ([]Event, error) {
+	resp, err := c.get(ctx, "/api/events?in_progress=1&limit=-1")
+	if err != nil {
+		return nil, fmt.Errorf("get events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get events: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var events []Event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("decode events: %w", err)
+	}
+	return events, nil
+}
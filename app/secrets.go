@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// minRedactLength keeps very short secrets from mangling unrelated log text.
+const minRedactLength = 4
+
+const redacted = "***"
+
+// envReference matches a credential that is entirely "${NAME}".
+var envReference = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// resolveSecret returns the value of one credential field. A *_file
+// variant reads the value from a file, as mounted by Docker or Kubernetes
+// secrets. The field itself may be "${NAME}" to read an environment
+// variable or "file:///path" to read a file. Trailing newlines are
+// stripped from file contents.
+func resolveSecret(field, value, file string) (string, error) {
+	if file != "" {
+		if value != "" {
+			return "", fmt.Errorf("%s and %s_file are both set", field, field)
+		}
+		return readSecretFile(field+"_file", file)
+	}
+	if m := envReference.FindStringSubmatch(value); m != nil {
+		resolved, ok := os.LookupEnv(m[1])
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", field, m[1])
+		}
+		return resolved, nil
+	}
+	if path, ok := strings.CutPrefix(value, "file://"); ok {
+		return readSecretFile(field, path)
+	}
+	return value, nil
+}
+
+func readSecretFile(field, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", field, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveSecrets replaces every credential reference in the config and its
+// instances with the referenced value and returns what could not be read.
+func (c *FrigateConfig) resolveSecrets() []string {
+	var problems []string
+	fields := []struct {
+		name  string
+		value *string
+		file  string
+	}{
+		{"username", &c.Username, c.UsernameFile},
+		{"password", &c.Password, c.PasswordFile},
+		{"mqtt.user", &c.MQTT.User, c.MQTT.UserFile},
+		{"mqtt.password", &c.MQTT.Password, c.MQTT.PasswordFile},
+		{"rtsp.username", &c.RTSP.Username, c.RTSP.UsernameFile},
+		{"rtsp.password", &c.RTSP.Password, c.RTSP.PasswordFile},
+		{"media.secret", &c.Media.Secret, c.Media.SecretFile},
+	}
+	for _, f := range fields {
+		resolved, err := resolveSecret(f.name, *f.value, f.file)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		*f.value = resolved
+	}
+	for i := range c.Instances {
+		for _, problem := range c.Instances[i].resolveSecrets() {
+			problems = append(problems, fmt.Sprintf("instance %q: %s", c.Instances[i].Name, problem))
+		}
+	}
+	return problems
+}
+
+// secretValues lists the resolved secrets that must never appear in logs
+// or entity state.
+func (c FrigateConfig) secretValues() []string {
+	values := []string{c.Password, c.MQTT.Password, c.RTSP.Password, c.Media.Secret}
+	for _, inst := range c.Instances {
+		values = append(values, inst.secretValues()...)
+	}
+	return values
+}
+
+var secrets struct {
+	sync.RWMutex
+	values []string
+	once   sync.Once
+}
+
+// setSecrets replaces the redaction list and routes the standard logger
+// through redact.
+func setSecrets(values []string) {
+	var keep []string
+	for _, v := range values {
+		if len(v) >= minRedactLength {
+			keep = append(keep, v)
+		}
+	}
+	secrets.Lock()
+	secrets.values = keep
+	secrets.Unlock()
+	secrets.once.Do(func() {
+		log.SetOutput(redactingWriter{w: log.Writer()})
+	})
+}
+
+// redact removes URL user info and every configured secret from s.
+func redact(s string) string {
+	s = redactURL(s)
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for _, v := range secrets.values {
+		s = strings.ReplaceAll(s, v, redacted)
+	}
+	return s
+}
+
+func redactError(err error) string {
+	return redact(err.Error())
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
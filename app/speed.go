@@ -0,0 +1,205 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+// SpeedConfig sets the speed above which objects in a zone with speed
+// calibration publish a speeding event. Zones overrides Threshold per
+// Frigate zone name; a threshold of 0 publishes nothing.
+type SpeedConfig struct {
+	Threshold float64            `json:"threshold,omitempty"`
+	Zones     map[string]float64 `json:"zones,omitempty"`
+}
+
+func (c SpeedConfig) threshold(zone string) float64 {
+	if t, ok := c.Zones[zone]; ok {
+		return t
+	}
+	return c.Threshold
+}
+
+func (c SpeedConfig) problems() []string {
+	var problems []string
+	if c.Threshold < 0 {
+		problems = append(problems, "speed.threshold must not be negative")
+	}
+	for zone, t := range c.Zones {
+		if t < 0 {
+			problems = append(problems, fmt.Sprintf("speed.zones[%q] must not be negative", zone))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// SpeedingEvent is published on "<last speed entity key>.event.speeding"
+// the first time an object in a zone exceeds the zone's threshold.
+type SpeedingEvent struct {
+	Camera       string  `json:"camera"`
+	Zone         string  `json:"zone"`
+	Label        string  `json:"label"`
+	EventID      string  `json:"event_id"`
+	Speed        float64 `json:"speed"`
+	AverageSpeed float64 `json:"average_speed,omitempty"`
+	Threshold    float64 `json:"threshold"`
+	Unit         string  `json:"unit"`
+}
+
+// zoneSpeed holds the estimated speeds seen in one calibrated zone.
+// Speeding is persisted with them, so a restart does not announce an event
+// again.
+type zoneSpeed struct {
+	Last     float64             `json:"last"`
+	MaxToday float64             `json:"max_today"`
+	Day      string              `json:"day"`
+	Speeding map[string]struct{} `json:"speeding,omitempty"` // events already announced
+}
+
+// speedZone reports whether Frigate can estimate speeds in a zone, which
+// needs distances between the zone's corners.
+func (z Zone) speedZone() bool {
+	return len(z.Distances) > 0
+}
+
+// speedUnit follows Frigate's ui.unit_system, which its estimates use.
+func speedUnit(unitSystem string) string {
+	if unitSystem == "imperial" {
+		return "mph"
+	}
+	return "km/h"
+}
+
+func speedEntityID(zone, kind string) string {
+	return "speed-" + sanitizeID(zone) + "-" + kind
+}
+
+// trackSpeedLocked records the estimated speed of an event in the
+// calibrated zones it is in and returns the speeding events to publish.
+// Callers hold a.mu.
+func (a *App) trackSpeedLocked(camera string, runtime *cameraRuntime, label string, event Event, now time.Time) []SpeedingEvent {
+	if event.CurrentEstimatedSpeed <= 0 {
+		return nil
+	}
+	today := now.In(a.config.Counters.location()).Format(time.DateOnly)
+	var due []SpeedingEvent
+	for name, zone := range a.cameras[camera].Zones {
+		if !zone.speedZone() || !slices.Contains(event.CurrentZones, name) {
+			continue
+		}
+		if runtime.Speeds == nil {
+			runtime.Speeds = make(map[string]*zoneSpeed)
+		}
+		speed := runtime.Speeds[name]
+		if speed == nil {
+			speed = &zoneSpeed{}
+			runtime.Speeds[name] = speed
+		}
+		if speed.Day != today {
+			speed.Day = today
+			speed.MaxToday = 0
+		}
+		speed.Last = event.CurrentEstimatedSpeed
+		speed.MaxToday = max(speed.MaxToday, event.CurrentEstimatedSpeed)
+
+		threshold := a.config.Speed.threshold(name)
+		if threshold <= 0 || event.CurrentEstimatedSpeed <= threshold {
+			continue
+		}
+		if _, ok := speed.Speeding[event.ID]; ok {
+			continue
+		}
+		if speed.Speeding == nil {
+			speed.Speeding = make(map[string]struct{})
+		}
+		speed.Speeding[event.ID] = struct{}{}
+		due = append(due, SpeedingEvent{
+			Camera:       camera,
+			Zone:         name,
+			Label:        label,
+			EventID:      event.ID,
+			Speed:        event.CurrentEstimatedSpeed,
+			AverageSpeed: event.AverageEstimatedSpeed,
+			Threshold:    threshold,
+			Unit:         speedUnit(a.unitSystem),
+		})
+	}
+	return due
+}
+
+func (r *cameraRuntime) forgetSpeeding(eventID string) {
+	for _, speed := range r.Speeds {
+		delete(speed.Speeding, eventID)
+	}
+}
+
+func (a *App) publishSpeeding(event SpeedingEvent) {
+	key := domain.EntityKey{Plugin: PluginID, DeviceID: a.deviceID(event.Camera), ID: speedEntityID(event.Zone, "last")}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("plugin-frigate: failed to encode speeding event: %v", err)
+		return
+	}
+	log.Printf("plugin-frigate: %s%s %s speeding in %s on %s at %.1f %s",
+		a.logPrefix(), event.Label, event.EventID, event.Zone, event.Camera, event.Speed, event.Unit)
+	if err := a.msg.Publish(key.Key()+".event.speeding", data); err != nil {
+		log.Printf("plugin-frigate: failed to publish speeding event for %s: %v", key.Key(), err)
+	}
+}
+
+// speedEntities has a last speed and a max speed today sensor per zone
+// with speed calibration.
+func (a *App) speedEntities(camera string, zones map[string]Zone, runtime *cameraRuntime) []domain.Entity {
+	names := make([]string, 0, len(zones))
+	for name, zone := range zones {
+		if zone.speedZone() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	a.mu.Lock()
+	unit := speedUnit(a.unitSystem)
+	a.mu.Unlock()
+	today := a.now().In(a.config.Counters.location()).Format(time.DateOnly)
+	entities := make([]domain.Entity, 0, 2*len(names))
+	for _, name := range names {
+		var last, maxToday float64
+		if runtime != nil {
+			if speed := runtime.Speeds[name]; speed != nil {
+				last = speed.Last
+				if speed.Day == today {
+					maxToday = speed.MaxToday
+				}
+			}
+		}
+		title := strings.Title(strings.ReplaceAll(name, "_", " "))
+		entities = append(entities,
+			domain.Entity{
+				ID:       speedEntityID(name, "last"),
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "sensor",
+				Name:     title + " Last Speed",
+				State:    domain.Sensor{Value: last, Unit: unit, DeviceClass: "speed"},
+			},
+			domain.Entity{
+				ID:       speedEntityID(name, "max-today"),
+				Plugin:   PluginID,
+				DeviceID: a.deviceID(camera),
+				Type:     "sensor",
+				Name:     title + " Max Speed Today",
+				State:    domain.Sensor{Value: maxToday, Unit: unit, DeviceClass: "speed"},
+			},
+		)
+	}
+	return entities
+}
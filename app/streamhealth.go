@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	domain "github.com/slidebolt/sb-domain"
+)
+
+const DefaultStreamHealthInterval = 30 * time.Second
+
+// stallSamples is how many checks in a row must see no new bytes before a
+// connected stream counts as stalled, so one slow interval is not reported.
+const stallSamples = 2
+
+// Stream health values reported in StreamState.Health.
+const (
+	StreamStreaming   = "streaming"
+	StreamIdle        = "idle"
+	StreamStalled     = "stalled"
+	StreamOffline     = "offline"
+	StreamUnreachable = "unreachable"
+)
+
+// StreamHealthConfig controls how often go2rtc streams are checked.
+type StreamHealthConfig struct {
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+func (c StreamHealthConfig) interval() time.Duration {
+	if c.IntervalSeconds > 0 {
+		return time.Duration(c.IntervalSeconds) * time.Second
+	}
+	return DefaultStreamHealthInterval
+}
+
+// StreamStatusState is the per-camera summary of its main stream's health.
+type StreamStatusState struct {
+	Degraded bool   `json:"degraded"`
+	Stream   string `json:"stream,omitempty"`
+	Health   string `json:"health,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// streamSample is the last health check of one go2rtc stream.
+type streamSample struct {
+	Health    string
+	Bytes     int64
+	Bitrate   int64
+	Consumers int
+	Unchanged int // consecutive checks without new bytes
+	At        time.Time
+}
+
+func (s streamSample) online() bool {
+	return s.Health == StreamStreaming || s.Health == StreamIdle
+}
+
+// assessStream compares a stream against its previous sample. A source that
+// is connected but received no bytes for stallSamples checks has stalled;
+// one that is not connected while clients are watching is offline.
+func assessStream(prev streamSample, stream Go2RTCStream, now time.Time) streamSample {
+	sample := streamSample{Consumers: len(stream.Consumers), At: now}
+	connected := false
+	for _, p := range stream.Producers {
+		received := p.BytesRecv
+		if received == 0 {
+			for _, r := range p.Receivers {
+				received += r.Bytes
+			}
+		}
+		sample.Bytes += received
+		if p.RemoteAddr != "" || received > 0 || len(p.Receivers) > 0 {
+			connected = true
+		}
+	}
+
+	switch {
+	case !connected && sample.Consumers > 0:
+		sample.Health = StreamOffline
+	case !connected:
+		sample.Health = StreamIdle
+	case prev.Health != "" && prev.Bytes > 0 && sample.Bytes == prev.Bytes:
+		sample.Unchanged = prev.Unchanged + 1
+		sample.Health = StreamStreaming
+		if sample.Unchanged >= stallSamples {
+			sample.Health = StreamStalled
+		}
+	default:
+		sample.Health = StreamStreaming
+		if elapsed := now.Sub(prev.At).Seconds(); prev.Bytes > 0 && sample.Bytes > prev.Bytes && elapsed > 0 {
+			sample.Bitrate = int64(float64(sample.Bytes-prev.Bytes) * 8 / elapsed)
+		}
+	}
+	return sample
+}
+
+// recordStreamHealthLocked samples every stream the cameras use, once per
+// check even when several cameras share a stream. When go2rtc could not be
+// reached all of them are marked unreachable. Callers hold a.mu.
+func (a *App) recordStreamHealthLocked(streams map[string]Go2RTCStream, err error, now time.Time) {
+	if a.streamHealth == nil {
+		a.streamHealth = make(map[string]streamSample)
+	}
+	names := make(map[string]struct{})
+	for camera := range a.cameras {
+		for _, stream := range cameraStreams(camera, a.cameras, a.streams) {
+			names[stream.Name] = struct{}{}
+		}
+	}
+	for name := range names {
+		if err != nil {
+			a.streamHealth[name] = streamSample{Health: StreamUnreachable, At: now}
+			continue
+		}
+		info, ok := streams[name]
+		if !ok {
+			a.streamHealth[name] = streamSample{Health: StreamOffline, At: now}
+			continue
+		}
+		a.streamHealth[name] = assessStream(a.streamHealth[name], info, now)
+	}
+}
+
+func (a *App) monitorStreams(ctx context.Context) {
+	ticker := a.newTicker(a.config.StreamHealth.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkStreamHealth(ctx)
+		}
+	}
+}
+
+// checkStreamHealth refreshes producer details and health of the known
+// streams. New or removed streams are picked up by the next reconcile.
+func (a *App) checkStreamHealth(ctx context.Context) {
+	if a.go2rtc == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	streams, err := a.go2rtc.GetStreams(ctx)
+	if err != nil {
+		log.Printf("plugin-frigate: stream health check error: %v", err)
+	}
+
+	a.mu.Lock()
+	if err == nil && a.streams.Known {
+		refreshed := make(map[string]Go2RTCStream, len(a.streams.Streams))
+		for name, info := range a.streams.Streams {
+			if latest, ok := streams[name]; ok {
+				info = latest
+			}
+			refreshed[name] = info
+		}
+		a.streams.Streams = refreshed
+	}
+	a.recordStreamHealthLocked(streams, err, time.Now())
+	cameras := make([]string, 0, len(a.cameras))
+	for camera := range a.cameras {
+		cameras = append(cameras, camera)
+	}
+	a.mu.Unlock()
+
+	sort.Strings(cameras)
+	for _, camera := range cameras {
+		entities := append(a.streamEntities(camera), a.streamStatusEntity(camera))
+		for _, entity := range a.allowedEntities(entities) {
+			if _, err := a.saveEntityIfChanged(entity); err != nil {
+				log.Printf("plugin-frigate: failed to update stream health for %s: %v", camera, err)
+			}
+		}
+	}
+}
+
+func (a *App) streamSampleFor(name string) (streamSample, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sample, ok := a.streamHealth[name]
+	return sample, ok
+}
+
+// streamStatusEntity reports the camera as degraded when its main stream's
+// source has disconnected, stalled or cannot be checked.
+func (a *App) streamStatusEntity(camera string) domain.Entity {
+	a.mu.Lock()
+	catalog := a.streams
+	cameras := a.cameras
+	a.mu.Unlock()
+
+	state := StreamStatusState{}
+	for _, stream := range cameraStreams(camera, cameras, catalog) {
+		if stream.Suffix != "" {
+			continue
+		}
+		state.Stream = stream.Name
+		if sample, ok := a.streamSampleFor(stream.Name); ok {
+			state.Health = sample.Health
+			if !sample.online() {
+				state.Degraded = true
+				state.Reason = "main stream " + sample.Health
+			}
+		}
+		break
+	}
+
+	return domain.Entity{
+		ID:       "stream-degraded",
+		Plugin:   PluginID,
+		DeviceID: a.deviceID(camera),
+		Type:     "frigate_stream_status",
+		Name:     "Stream Degraded",
+		State:    state,
+	}
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+// CameraTalkback plays audio through a camera's backchannel. Either URL
+// (e.g. a TTS service) or base64 Data is required; uploads are served to
+// go2rtc through the media proxy. Codec is the camera's audio codec and
+// defaults to the one its backchannel reports.
+type CameraTalkback struct {
+	URL    string `json:"url,omitempty"`
+	Data   string `json:"data,omitempty"`
+	Format string `json:"format,omitempty"`
+	Codec  string `json:"codec,omitempty"`
+}
+
+// talkbackCodecs are the audio codecs go2rtc's ffmpeg source can encode
+// for a backchannel.
+var talkbackCodecs = map[string]bool{
+	"pcma": true,
+	"pcmu": true,
+	"pcm":  true,
+	"pcml": true,
+	"opus": true,
+	"aac":  true,
+	"mp3":  true,
+}
+
+// validate rejects anything that could add go2rtc source options, which
+// follow a "#" in the source it is given.
+func (c CameraTalkback) validate() error {
+	if (c.URL == "") == (c.Data == "") {
+		return fmt.Errorf("exactly one of url or data is required")
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("url %q must be http or https", c.URL)
+		}
+		if u.Fragment != "" || strings.Contains(c.URL, "#") {
+			return fmt.Errorf("url %q must not have a fragment", c.URL)
+		}
+	}
+	if c.Codec != "" && !talkbackCodecs[strings.ToLower(c.Codec)] {
+		return fmt.Errorf("unsupported codec %q", c.Codec)
+	}
+	for _, r := range strings.TrimPrefix(c.Format, ".") {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("invalid format %q", c.Format)
+		}
+	}
+	return nil
+}
+
+type TalkbackResult struct {
+	OK     bool   `json:"ok"`
+	Camera string `json:"camera"`
+	Stream string `json:"stream,omitempty"`
+	Codec  string `json:"codec,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// backchannelCodec reports whether a go2rtc stream accepts audio from
+// clients and which codec it expects. Producers list the backchannel as a
+// "audio, sendonly, <codec>" media.
+func backchannelCodec(stream Go2RTCStream) (string, bool) {
+	for _, p := range stream.Producers {
+		for _, media := range p.Medias {
+			parts := strings.Split(media, ",")
+			if len(parts) < 2 || strings.TrimSpace(parts[0]) != "audio" || strings.TrimSpace(parts[1]) != "sendonly" {
+				continue
+			}
+			codec := ""
+			if len(parts) > 2 {
+				codec = strings.ToLower(strings.TrimSpace(parts[2]))
+				if i := strings.Index(codec, "/"); i >= 0 {
+					codec = codec[:i]
+				}
+			}
+			return codec, true
+		}
+	}
+	return "", false
+}
+
+// knowsMedias reports whether go2rtc described the stream's media, which it
+// only does while a producer is connected.
+func knowsMedias(stream Go2RTCStream) bool {
+	for _, p := range stream.Producers {
+		if len(p.Medias) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Play asks go2rtc to send src to the backchannel of stream dst.
+func (c *Go2RTCClient) Play(ctx context.Context, dst, src string) error {
+	query := url.Values{"dst": {dst}, "src": {src}}
+	resp, err := c.post(ctx, "/streams?"+query.Encode(), "", nil)
+	if err != nil {
+		return fmt.Errorf("play: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("play: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (a *App) handleTalkback(cameraID, entityID string, cmd CameraTalkback, msg *messenger.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result := TalkbackResult{Camera: cameraID}
+	if err := cmd.validate(); err != nil {
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+	stream, _, ok := a.streamForEntity(cameraID, entityID)
+	if !ok || a.go2rtc == nil {
+		result.Error = fmt.Sprintf("no go2rtc stream for %s.%s", cameraID, entityID)
+		reply(msg, result)
+		return
+	}
+	result.Stream = stream
+
+	a.mu.Lock()
+	info := a.streams.Streams[stream]
+	a.mu.Unlock()
+	codec, backchannel := backchannelCodec(info)
+	if !backchannel && knowsMedias(info) {
+		result.Error = fmt.Sprintf("stream %s has no audio backchannel", stream)
+		reply(msg, result)
+		return
+	}
+	if cmd.Codec != "" {
+		codec = strings.ToLower(cmd.Codec)
+	}
+	if codec == "" {
+		codec = "pcma"
+	}
+	result.Codec = codec
+
+	source := cmd.URL
+	if cmd.Data != "" {
+		if a.media == nil {
+			result.Error = "audio uploads need the media proxy (media.listen)"
+			reply(msg, result)
+			return
+		}
+		data, err := base64.StdEncoding.DecodeString(cmd.Data)
+		if err != nil {
+			result.Error = fmt.Sprintf("decode data: %v", err)
+			reply(msg, result)
+			return
+		}
+		source, err = a.media.storeTalkback(data, cmd.Format)
+		if err != nil {
+			result.Error = redactError(err)
+			reply(msg, result)
+			return
+		}
+	}
+
+	src := "ffmpeg:" + source + "#audio=" + codec + "#input=file"
+	if err := a.go2rtc.Play(ctx, stream, src); err != nil {
+		log.Printf("plugin-frigate: talkback on %s failed: %v", stream, err)
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+
+	log.Printf("plugin-frigate: playing talkback audio on %s", stream)
+	result.OK = true
+	reply(msg, result)
+}
+
+const talkbackPrefix = "talkback-"
+
+// storeTalkback keeps uploaded audio in the media cache and returns a signed
+// URL go2rtc can fetch it from. The cache's age limit removes it later.
+func (m *mediaService) storeTalkback(data []byte, format string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("talkback id: %w", err)
+	}
+	ext := strings.Trim(strings.ToLower(format), ".")
+	if ext == "" {
+		ext = "wav"
+	}
+	name := hex.EncodeToString(id) + "." + ext
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.WriteFile(filepath.Join(m.cacheDir, talkbackPrefix+name), data, 0o644); err != nil {
+		return "", fmt.Errorf("store talkback audio: %w", err)
+	}
+	m.pruneLocked()
+	return m.signedURL("/media/talkback/" + name), nil
+}
+
+// serveTalkback answers /media/talkback/<name> from the cache.
+func (m *mediaService) serveTalkback(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(m.cacheDir, talkbackPrefix+name))
+}
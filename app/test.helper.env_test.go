@@ -0,0 +1,70 @@
+package app_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	testkit "github.com/slidebolt/sb-testkit"
+)
+
+// newTestEnv starts the messenger and storage services the plugin needs.
+func newTestEnv(t *testing.T) *testkit.TestEnv {
+	t.Helper()
+	env := testkit.NewTestEnv(t)
+	env.Start("messenger")
+	env.Start("storage")
+	return env
+}
+
+// startPlugin starts the plugin against env after applying opts, such as
+// withClock. The caller shuts it down.
+func startPlugin(t *testing.T, env *testkit.TestEnv, opts ...func(*frigateapp.App)) *frigateapp.App {
+	t.Helper()
+	app := frigateapp.New()
+	for _, opt := range opts {
+		opt(app)
+	}
+	if _, err := app.OnStart(map[string]json.RawMessage{
+		"messenger": env.MessengerPayload(),
+	}); err != nil {
+		t.Fatalf("OnStart: %v", err)
+	}
+	return app
+}
+
+// startApp is startPlugin with the plugin shut down when the test ends.
+func startApp(t *testing.T, env *testkit.TestEnv, opts ...func(*frigateapp.App)) *frigateapp.App {
+	t.Helper()
+	app := startPlugin(t, env, opts...)
+	t.Cleanup(func() { app.OnShutdown() })
+	return app
+}
+
+// testClock is a clock tests move by hand.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock(now time.Time) *testClock {
+	return &testClock{now: now}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func withClock(c *testClock) func(*frigateapp.App) {
+	return func(a *frigateapp.App) { a.SetClock(c.Now) }
+}
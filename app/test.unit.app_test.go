@@ -317,7 +317,7 @@ func TestDiscoveryCreatesOneDevicePerCamera(t *testing.T) {
 	}
 	deviceCount := 0
 	for _, e := range entries {
-		if strings.Count(e.Key, ".") == 1 {
+		if strings.Count(e.Key, ".") == 1 && e.Key != frigateapp.PluginID+"."+frigateapp.PluginDeviceID {
 			deviceCount++
 		}
 	}
@@ -340,7 +340,7 @@ func TestReconcileRemovesStaleCamera(t *testing.T) {
 	}))
 	defer server.Close()
 
-	t.Setenv("FRIGATE_URL", server.URL)
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","deletion":{"grace_reconciles":1}}`)
 
 	env := testkit.NewTestEnv(t)
 	env.Start("messenger")
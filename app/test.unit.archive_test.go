@@ -0,0 +1,204 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	storage "github.com/slidebolt/sb-storage-sdk"
+)
+
+func TestArchiveMatchingEventsWithRetention(t *testing.T) {
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/events/evt-1/snapshot.jpg", "/api/events/evt-2/snapshot.jpg", "/api/events/evt-3/snapshot.jpg":
+			w.Write([]byte("0123456789"))
+		case "/api/events/evt-1/clip.mp4":
+			w.Write([]byte("clip"))
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Setenv("FRIGATE_CONFIG", `{
+		"url":"`+server.URL+`",
+		"archive":{"dir":"`+dir+`","max_bytes":20,"rules":[
+			{"name":"people","labels":["person"],"include_clip":true}
+		]}
+	}`)
+
+	env := newTestEnv(t)
+
+	app := startApp(t, env)
+
+	store := env.Storage()
+	if count := archiveCount(t, store); count != 0 {
+		t.Fatalf("archive count before events = %d, want 0", count)
+	}
+
+	end := func(id, label string, start int) {
+		t.Helper()
+		payload := `{"type":"end","after":{"id":"` + id + `","label":"` + label + `","camera":"front_door","start_time":` +
+			strconv.Itoa(start) + `,"end_time":` + strconv.Itoa(start+10) + `,"has_snapshot":true,"has_clip":true}}`
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", id, err)
+		}
+	}
+
+	end("evt-1", "person", 1710000000)
+	end("car-1", "car", 1710000001)
+	waitFor(t, func() bool { return archiveCount(t, store) == 1 })
+
+	if data, err := os.ReadFile(filepath.Join(dir, "front_door", "evt-1.jpg")); err != nil || string(data) != "0123456789" {
+		t.Fatalf("archived snapshot = %q, %v", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "front_door", "evt-1.mp4")); err != nil || string(data) != "clip" {
+		t.Fatalf("archived clip = %q, %v", data, err)
+	}
+	entries, err := store.SearchFiles(storage.Internal, frigateapp.PluginID+".archive.>")
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("archive index entries = %d, want 1", len(entries))
+	}
+
+	// evt-1 holds 14 bytes; evt-2 pushes the archive over 20 so the oldest goes.
+	end("evt-2", "person", 1710000100)
+	waitFor(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "front_door", "evt-1.jpg"))
+		return os.IsNotExist(err) && archiveCount(t, store) == 1
+	})
+	if _, err := os.Stat(filepath.Join(dir, "front_door", "evt-2.jpg")); err != nil {
+		t.Fatalf("newest archive missing: %v", err)
+	}
+}
+
+func TestArchiveStreamsSlowClipsAndRejectsUnknownCameras(t *testing.T) {
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/events/evt-1/snapshot.jpg", "/api/events/evt-2/snapshot.jpg":
+			w.Write([]byte("jpeg"))
+		case "/api/events/evt-1/clip.mp4":
+			// Slower than the API timeout, which must not apply to clips.
+			w.Write([]byte("slow-"))
+			w.(http.Flusher).Flush()
+			time.Sleep(600 * time.Millisecond)
+			w.Write([]byte("clip"))
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "archive")
+	t.Setenv("FRIGATE_CONFIG", `{
+		"url":"`+server.URL+`","timeout_ms":300,
+		"archive":{"dir":"`+dir+`","rules":[{"name":"people","labels":["person"],"include_clip":true}]}
+	}`)
+
+	env := newTestEnv(t)
+	app := startApp(t, env)
+	store := env.Storage()
+
+	// The unknown camera has no device to update, which HandleMQTTEvent
+	// reports; what matters is that nothing is written for it.
+	app.HandleMQTTEvent([]byte(`{"type":"end","after":{"id":"evt-2","label":"person","camera":"../escape","start_time":1710000000,"end_time":1710000010,"has_snapshot":true}}`))
+	if err := app.HandleMQTTEvent([]byte(`{"type":"end","after":{"id":"evt-1","label":"person","camera":"front_door","start_time":1710000000,"end_time":1710000010,"has_snapshot":true,"has_clip":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(evt-1): %v", err)
+	}
+	waitFor(t, func() bool { return archiveCount(t, store) == 1 })
+
+	if data, err := os.ReadFile(filepath.Join(dir, "front_door", "evt-1.mp4")); err != nil || string(data) != "slow-clip" {
+		t.Fatalf("archived clip = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "escape")); !os.IsNotExist(err) {
+		t.Fatalf("event for an unknown camera was archived outside the archive dir: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "front_door"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("archive dir has %d files, want the snapshot and clip without temporaries", len(entries))
+	}
+}
+
+func TestReloadDisablingArchiveDuringDownload(t *testing.T) {
+	config := singleCameraConfigHandler("front_door")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finish := sync.OnceFunc(func() { close(release) })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/events/evt-1/snapshot.jpg" {
+			config(w, r)
+			return
+		}
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("jpeg"))
+	}))
+	defer server.Close()
+	defer finish()
+
+	t.Chdir(t.TempDir())
+	writeConfig := func(config string) {
+		t.Helper()
+		if err := os.WriteFile("config.json", []byte(config), 0o644); err != nil {
+			t.Fatalf("write config.json: %v", err)
+		}
+	}
+	writeConfig(`{"url":"` + server.URL + `","archive":{"dir":"archive","rules":[{"name":"people","labels":["person"]}]}}`)
+
+	env := newTestEnv(t)
+	app := startApp(t, env)
+	store := env.Storage()
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"end","after":{"id":"evt-1","label":"person","camera":"front_door","start_time":1710000000,"end_time":1710000010,"has_snapshot":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(evt-1): %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("archive download did not start")
+	}
+
+	// The reload drops the archive while the snapshot is still downloading.
+	writeConfig(`{"url":"` + server.URL + `","cameras":{"overrides":{"front_door":{"name":"Porch"}}}}`)
+	waitFor(t, func() bool { return getDevice(t, store, frigateapp.PluginID, "front_door").Name == "Porch" })
+	finish()
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join("archive", "front_door", "evt-1.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("download finished after the archive was disabled: %v", err)
+	}
+}
+
+func archiveCount(t *testing.T, store storage.Storage) int {
+	t.Helper()
+	entity := getEntity(t, store, frigateapp.PluginID, "front_door", "archive-count")
+	return entity.State.(frigateapp.StatusSensorState).Count
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
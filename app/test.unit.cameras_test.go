@@ -0,0 +1,101 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestCameraFiltersAndProfiles(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front", "back", "test_cam", "birdseye"))
+	defer server.Close()
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	start := func(config string) {
+		t.Helper()
+		t.Setenv("FRIGATE_CONFIG", config)
+		startPlugin(t, env).OnShutdown()
+	}
+	exists := func(key domain.EntityKey) bool {
+		_, err := store.Get(key)
+		return err == nil
+	}
+	entity := func(device, id string) domain.EntityKey {
+		return domain.EntityKey{Plugin: frigateapp.PluginID, DeviceID: device, ID: id}
+	}
+
+	start(`{"url":"` + server.URL + `"}`)
+	for _, id := range []string{"front", "back", "test_cam", "birdseye"} {
+		getDevice(t, store, frigateapp.PluginID, id)
+	}
+	if !exists(entity("back", "detect-enable")) || !exists(entity("front", "stream-main")) {
+		t.Fatal("full profile should create controls and streams")
+	}
+
+	start(`{"url":"` + server.URL + `","cameras":{
+		"exclude":["test_*","birdseye"],
+		"profile":"standard",
+		"overrides":{"front":{"name":"Front Door","area":"Porch","profile":"minimal"}}
+	}}`)
+
+	for _, id := range []string{"test_cam", "birdseye"} {
+		if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: id}); err == nil {
+			t.Fatalf("excluded camera %s should be deleted right away", id)
+		}
+	}
+
+	front := getDevice(t, store, frigateapp.PluginID, "front")
+	if front.Name != "Front Door" {
+		t.Fatalf("front device name = %q, want Front Door", front.Name)
+	}
+	if state := getEntity(t, store, frigateapp.PluginID, "front", "camera-state").State.(frigateapp.CameraState); state.Area != "Porch" {
+		t.Fatalf("front area = %q, want Porch", state.Area)
+	}
+	if !exists(entity("front", "camera-state")) || !exists(entity("front", "status-all-occupancy")) {
+		t.Fatal("minimal profile should keep core and event entities")
+	}
+	for _, id := range []string{"stream-main", "status-detect", "detect-enable", "manual-event"} {
+		if exists(entity("front", id)) {
+			t.Fatalf("minimal profile kept front.%s", id)
+		}
+	}
+
+	for _, id := range []string{"stream-main", "status-detect", "image-latest"} {
+		if !exists(entity("back", id)) {
+			t.Fatalf("standard profile is missing back.%s", id)
+		}
+	}
+	for _, id := range []string{"detect-enable", "manual-event", "exports"} {
+		if exists(entity("back", id)) {
+			t.Fatalf("standard profile kept back.%s", id)
+		}
+	}
+
+	app := startApp(t, env)
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front","start_time":1710000000,"has_clip":true,"has_snapshot":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent: %v", err)
+	}
+	for _, id := range []string{"image-person-snapshot", "clip-person", "status-detect"} {
+		if exists(entity("front", id)) {
+			t.Fatalf("event on minimal front created front.%s", id)
+		}
+	}
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".back.exports.command.frigate_export", []byte(`{"last":"1m"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("export request: %v", err)
+	}
+	var result frigateapp.ExportResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal reply: %v", err)
+	}
+	if result.OK || !strings.Contains(result.Error, "not enabled") {
+		t.Fatalf("export reply for standard back = %+v, want it rejected", result)
+	}
+}
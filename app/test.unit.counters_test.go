@@ -0,0 +1,103 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestWindowedCounters(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","counters":{"timezone":"America/New_York"}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	clock := newTestClock(time.Date(2026, 3, 10, 23, 50, 0, 0, newYork))
+	app := startApp(t, env, withClock(clock))
+
+	counts := func(id string) frigateapp.WindowCountsState {
+		t.Helper()
+		return getEntity(t, store, frigateapp.PluginID, "front", id).State.(frigateapp.WindowCountsState)
+	}
+	send := func(payload string) {
+		t.Helper()
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+
+	send(`{"type":"new","after":{"id":"evt-1","label":"car","camera":"front","start_time":1773201000,"entered_zones":["driveway"]}}`)
+	send(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"front","start_time":1773201000,"entered_zones":["driveway"]}}`)
+	clock.Advance(30 * time.Minute)
+	send(`{"type":"new","after":{"id":"evt-2","label":"person","camera":"front","start_time":1773202800}}`)
+
+	all := counts("counts-all")
+	if all.Today != 1 || all.LastHour != 2 || all.Last24h != 2 || all.Last7d != 2 || all.Value != "1 today" {
+		t.Fatalf("counts-all = %+v, want 1 today and 2 in every rolling window", all)
+	}
+	if car := counts("counts-car"); car.Today != 0 || car.LastHour != 1 {
+		t.Fatalf("counts-car = %+v, want yesterday's car in the last hour", car)
+	}
+	if zone := counts("counts-zone-driveway"); zone.LastHour != 1 {
+		t.Fatalf("counts-zone-driveway = %+v, want one entry", zone)
+	}
+
+	clock.Advance(2 * 24 * time.Hour)
+	send(`{"type":"end","after":{"id":"evt-2","label":"person","camera":"front","start_time":1773202800,"end_time":1773202900}}`)
+	all = counts("counts-all")
+	if all.Today != 0 || all.Last24h != 0 || all.Last7d != 2 {
+		t.Fatalf("counts-all two days later = %+v, want only the 7d window", all)
+	}
+
+	clock.Advance(7 * 24 * time.Hour)
+	send(`{"type":"new","after":{"id":"evt-3","label":"person","camera":"front","start_time":1774000000}}`)
+	if all = counts("counts-all"); all.Last7d != 1 {
+		t.Fatalf("counts-all a week later = %+v, want old buckets expired", all)
+	}
+}
+
+func TestCountersDecayWithoutEvents(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","counters":{"timezone":"America/New_York"}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	clock := newTestClock(time.Date(2026, 3, 10, 22, 5, 0, 0, newYork))
+	app := startApp(t, env, withClock(clock))
+
+	counts := func() frigateapp.WindowCountsState {
+		return getEntity(t, store, frigateapp.PluginID, "front", "counts-all").State.(frigateapp.WindowCountsState)
+	}
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"car","camera":"front","start_time":1773194700}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent: %v", err)
+	}
+	if all := counts(); all.Today != 1 || all.LastHour != 1 {
+		t.Fatalf("counts-all = %+v, want one event", all)
+	}
+
+	clock.Advance(75 * time.Minute)
+	waitFor(t, func() bool { return counts().LastHour == 0 })
+	if all := counts(); all.Today != 1 || all.Last24h != 1 {
+		t.Fatalf("counts-all an hour later = %+v, want the event still counted today", all)
+	}
+
+	clock.Advance(time.Hour)
+	waitFor(t, func() bool { return counts().Today == 0 })
+	if all := counts(); all.Last24h != 1 || all.Value != "0 today" {
+		t.Fatalf("counts-all after midnight = %+v, want today reset", all)
+	}
+}
@@ -0,0 +1,115 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestMissingCamerasAreProtectedBeforeDeletion(t *testing.T) {
+	var cameras atomic.Pointer[[]string]
+	all := []string{"front", "back", "side", "garage"}
+	cameras.Store(&all)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiCameraConfigHandler(*cameras.Load()...)(w, r)
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	reconcile := func(names ...string) {
+		t.Helper()
+		cameras.Store(&names)
+		startPlugin(t, env).OnShutdown()
+	}
+	available := func(device string) bool {
+		t.Helper()
+		return getEntity(t, store, frigateapp.PluginID, device, "availability").State.(frigateapp.AvailabilityState).Available
+	}
+
+	reconcile(all...)
+
+	// Frigate restarting with an empty config, for longer than the grace
+	// period: everything is kept and no camera gets closer to deletion.
+	for i := 0; i < 4; i++ {
+		reconcile()
+	}
+	for _, device := range all {
+		getDevice(t, store, frigateapp.PluginID, device)
+		if available(device) {
+			t.Fatalf("%s available with empty Frigate config", device)
+		}
+	}
+
+	reconcile("front", "back", "side")
+	if !available("front") {
+		t.Fatal("front should be available again")
+	}
+	getDevice(t, store, frigateapp.PluginID, "garage")
+	getEntity(t, store, frigateapp.PluginID, "garage", "camera-state")
+	if available("garage") {
+		t.Fatal("garage should stay unavailable while missing")
+	}
+
+	reconcile("front", "back", "side")
+	getDevice(t, store, frigateapp.PluginID, "garage")
+
+	reconcile("front", "back", "side")
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "garage"}); err == nil {
+		t.Fatal("garage should be deleted after three missing reconciles")
+	}
+	stale, err := store.Search(frigateapp.PluginID + ".garage.>")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(stale) != 0 {
+		t.Fatalf("garage entities = %d, want 0", len(stale))
+	}
+	getDevice(t, store, frigateapp.PluginID, "front")
+}
+
+func TestRenamingTheOnlyCameraIsNotGuarded(t *testing.T) {
+	var cameras atomic.Pointer[[]string]
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiCameraConfigHandler(*cameras.Load()...)(w, r)
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	reconcile := func(names ...string) {
+		t.Helper()
+		cameras.Store(&names)
+		startPlugin(t, env).OnShutdown()
+	}
+
+	reconcile("front")
+	// Renaming the only camera misses all stored cameras, but Frigate still
+	// reports one, so the old name goes after the grace period.
+	for i := 0; i < 2; i++ {
+		reconcile("porch")
+		getDevice(t, store, frigateapp.PluginID, "front")
+	}
+	reconcile("porch")
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "front"}); err == nil {
+		t.Fatal("front should be deleted after three missing reconciles")
+	}
+	getDevice(t, store, frigateapp.PluginID, "porch")
+
+	// An empty config still never deletes the last camera.
+	for i := 0; i < 4; i++ {
+		reconcile()
+	}
+	getDevice(t, store, frigateapp.PluginID, "porch")
+}
@@ -0,0 +1,60 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestEventMediaEntitiesFollowMQTTUpdates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(singleCameraConfigHandler("front_door")))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","snapshot":{"crop":true,"bbox":true,"quality":70}}`)
+
+	env := newTestEnv(t)
+
+	app := startApp(t, env)
+
+	store := env.Storage()
+
+	before := getEntity(t, store, frigateapp.PluginID, "front_door", "image-person-snapshot").State.(frigateapp.ImageState)
+	if before.URL != "" || before.Online {
+		t.Fatalf("snapshot before events = %+v, want empty offline", before)
+	}
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front_door","start_time":1710000000,"has_snapshot":false,"has_clip":false}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(new): %v", err)
+	}
+
+	snapshot := getEntity(t, store, frigateapp.PluginID, "front_door", "image-person-snapshot").State.(frigateapp.ImageState)
+	if snapshot.URL != server.URL+"/api/events/evt-1/snapshot.jpg?bbox=1&crop=1&quality=70" {
+		t.Fatalf("snapshot URL = %q", snapshot.URL)
+	}
+	if snapshot.Online || snapshot.EventID != "evt-1" {
+		t.Fatalf("snapshot before has_snapshot = %+v, want offline evt-1", snapshot)
+	}
+	clip := getEntity(t, store, frigateapp.PluginID, "front_door", "clip-person").State.(frigateapp.ClipState)
+	if clip.Online {
+		t.Fatalf("clip before has_clip = %+v, want offline", clip)
+	}
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"update","after":{"id":"evt-1","label":"person","camera":"front_door","start_time":1710000000,"has_snapshot":true,"has_clip":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(update): %v", err)
+	}
+
+	snapshot = getEntity(t, store, frigateapp.PluginID, "front_door", "image-person-snapshot").State.(frigateapp.ImageState)
+	if !snapshot.Online {
+		t.Fatalf("snapshot after has_snapshot = %+v, want online", snapshot)
+	}
+	thumbnail := getEntity(t, store, frigateapp.PluginID, "front_door", "image-person-thumbnail").State.(frigateapp.ImageState)
+	if thumbnail.URL != server.URL+"/api/events/evt-1/thumbnail.jpg" || !thumbnail.Online {
+		t.Fatalf("thumbnail = %+v", thumbnail)
+	}
+	clip = getEntity(t, store, frigateapp.PluginID, "front_door", "clip-person").State.(frigateapp.ClipState)
+	if clip.URL != server.URL+"/api/events/evt-1/clip.mp4" || !clip.Online {
+		t.Fatalf("clip after has_clip = %+v, want online", clip)
+	}
+}
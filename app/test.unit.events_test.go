@@ -0,0 +1,124 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestCreateAndEndManualEvent(t *testing.T) {
+	var mu sync.Mutex
+	var createBody map[string]any
+	var endedPath string
+
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/events/front_door/doorbell/create":
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			json.Unmarshal(body, &createBody)
+			mu.Unlock()
+			fmt.Fprintln(w, `{"success":true,"message":"Event created successfully","event_id":"1710000000.0-abc123"}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/api/events/1710000000.0-abc123/end":
+			mu.Lock()
+			endedPath = r.URL.Path
+			mu.Unlock()
+			fmt.Fprintln(w, `{"success":true,"message":"Event ended successfully"}`)
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	msg := env.Messenger()
+
+	resp, err := msg.Request(frigateapp.PluginID+".front_door.manual-event.command.frigate_create_event",
+		[]byte(`{"label":"Doorbell","sub_label":"ring","score":0.9,"include_recording":true}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("create event request: %v", err)
+	}
+	var created frigateapp.ManualEventResult
+	if err := json.Unmarshal(resp.Data, &created); err != nil {
+		t.Fatalf("unmarshal create reply: %v", err)
+	}
+	if !created.OK || created.EventID != "1710000000.0-abc123" {
+		t.Fatalf("create reply = %+v, want ok with event id", created)
+	}
+
+	mu.Lock()
+	if createBody["sub_label"] != "ring" || createBody["include_recording"] != true || createBody["duration"] != nil {
+		t.Fatalf("create body = %v", createBody)
+	}
+	mu.Unlock()
+
+	manual := getEntity(t, store, frigateapp.PluginID, "front_door", "manual-event")
+	state, ok := manual.State.(frigateapp.ManualEventState)
+	if !ok {
+		t.Fatalf("manual event state type = %T, want ManualEventState", manual.State)
+	}
+	if state.LastEventID != "1710000000.0-abc123" || !state.Active || state.Label != "doorbell" {
+		t.Fatalf("manual event state = %+v", state)
+	}
+
+	resp, err = msg.Request(frigateapp.PluginID+".front_door.manual-event.command.frigate_end_event", []byte(`{}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("end event request: %v", err)
+	}
+	var ended frigateapp.ManualEventResult
+	if err := json.Unmarshal(resp.Data, &ended); err != nil {
+		t.Fatalf("unmarshal end reply: %v", err)
+	}
+	if !ended.OK || ended.EventID != "1710000000.0-abc123" {
+		t.Fatalf("end reply = %+v, want ok for last created event", ended)
+	}
+	mu.Lock()
+	if endedPath == "" {
+		t.Fatal("PUT /api/events/<id>/end was not called")
+	}
+	mu.Unlock()
+
+	manual = getEntity(t, store, frigateapp.PluginID, "front_door", "manual-event")
+	state = manual.State.(frigateapp.ManualEventState)
+	if state.Active || state.EndedAt == "" {
+		t.Fatalf("manual event state after end = %+v, want inactive with end time", state)
+	}
+}
+
+func TestCreateManualEventRejectsMissingLabel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(singleCameraConfigHandler("front_door")))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.manual-event.command.frigate_create_event",
+		[]byte(`{"sub_label":"ring"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("create event request: %v", err)
+	}
+	var result frigateapp.ManualEventResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal reply: %v", err)
+	}
+	if result.OK || result.Error == "" {
+		t.Fatalf("reply = %+v, want validation error", result)
+	}
+}
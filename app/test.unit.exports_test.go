@@ -0,0 +1,163 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestExportLastMinutesTracksExports(t *testing.T) {
+	var mu sync.Mutex
+	var exportPath string
+
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/export/front_door/start/"):
+			mu.Lock()
+			exportPath = r.URL.Path
+			mu.Unlock()
+			fmt.Fprintln(w, `{"success":true,"message":"Starting export of recording.","export_id":"front_door_new"}`)
+		case r.URL.Path == "/api/exports":
+			fmt.Fprintln(w, `[
+				{"id":"front_door_new","camera":"front_door","name":"Doorbell","date":1710000300,"video_path":"/media/frigate/exports/front_door_new.mp4","thumb_path":"/media/frigate/clips/export/front_door_new.webp","in_progress":true},
+				{"id":"front_door_old","camera":"front_door","name":"Old","date":1710000000,"video_path":"/media/frigate/exports/front_door_old.mp4","thumb_path":"","in_progress":false},
+				{"id":"garage_old","camera":"garage","name":"Other","date":1710000000,"video_path":"/media/frigate/exports/garage_old.mp4","in_progress":false}
+			]`)
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	button := getEntity(t, store, frigateapp.PluginID, "front_door", "export-last-5m")
+	if len(button.Commands) != 1 || button.Commands[0] != "frigate_export" {
+		t.Fatalf("export button commands = %v", button.Commands)
+	}
+
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.exports.command.frigate_export",
+		[]byte(`{"last":"5m","name":"Doorbell"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("export request: %v", err)
+	}
+	var result frigateapp.ExportResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal reply: %v", err)
+	}
+	if !result.OK || result.ExportID != "front_door_new" || result.End-result.Start != 300 {
+		t.Fatalf("export reply = %+v", result)
+	}
+
+	mu.Lock()
+	wantPath := "/api/export/front_door/start/" + strconv.FormatInt(result.Start, 10) + "/end/" + strconv.FormatInt(result.End, 10)
+	if exportPath != wantPath {
+		t.Fatalf("export path = %q, want %q", exportPath, wantPath)
+	}
+	mu.Unlock()
+
+	state := getEntity(t, store, frigateapp.PluginID, "front_door", "exports").State.(frigateapp.ExportsState)
+	if state.InProgress != 1 || state.Completed != 1 || len(state.Exports) != 2 {
+		t.Fatalf("exports state = %+v, want 1 in progress and 1 completed", state)
+	}
+	if state.Exports[0].URL != "" {
+		t.Fatalf("in-progress export URL = %q, want empty", state.Exports[0].URL)
+	}
+	if state.Exports[1].URL != server.URL+"/exports/front_door_old.mp4" {
+		t.Fatalf("completed export URL = %q", state.Exports[1].URL)
+	}
+}
+
+func TestExportRejectsMixedRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(singleCameraConfigHandler("front_door")))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.exports.command.frigate_export",
+		[]byte(`{"start":1710000000,"end":1710000300,"last":"5m"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("export request: %v", err)
+	}
+	var result frigateapp.ExportResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal reply: %v", err)
+	}
+	if result.OK || result.Error == "" {
+		t.Fatalf("export reply = %+v, want range error", result)
+	}
+}
+
+func TestExportsAreSkippedWithoutEndpointAndWatchedOnce(t *testing.T) {
+	var lists atomic.Int32
+	var supported atomic.Bool
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/export/front_door/start/"):
+			fmt.Fprintln(w, `{"success":true,"message":"Starting export of recording.","export_id":"front_door_new"}`)
+		case r.URL.Path == "/api/exports":
+			lists.Add(1)
+			if !supported.Load() {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintln(w, `[{"id":"front_door_new","camera":"front_door","date":1710000300,"in_progress":true}]`)
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_URL", server.URL)
+	env := newTestEnv(t)
+	app := startPlugin(t, env)
+
+	reconcile := func() {
+		t.Helper()
+		if _, err := env.Messenger().Request(frigateapp.PluginID+"."+frigateapp.PluginDeviceID+".reconcile.command.frigate_reconcile", []byte(`{}`), 5*time.Second); err != nil {
+			t.Fatalf("reconcile request: %v", err)
+		}
+	}
+	reconcile()
+	reconcile()
+	if got := lists.Load(); got != 1 {
+		t.Fatalf("/api/exports requests = %d, want 1 after a 404", got)
+	}
+
+	app.OnShutdown()
+
+	// After a restart the plugin asks again. Exports started while a
+	// watcher polls share it.
+	supported.Store(true)
+	startApp(t, env)
+	lists.Store(0)
+	for i := 0; i < 3; i++ {
+		if _, err := env.Messenger().Request(frigateapp.PluginID+".front_door.exports.command.frigate_export", []byte(`{"last":"1m"}`), 5*time.Second); err != nil {
+			t.Fatalf("export request: %v", err)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+	if got := lists.Load(); got != 1 {
+		t.Fatalf("/api/exports requests = %d after three exports, want one watcher", got)
+	}
+}
@@ -0,0 +1,151 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestMultipleInstancesNamespaceDevices(t *testing.T) {
+	house := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer house.Close()
+
+	var barnDown atomic.Bool
+	var barnCreates atomic.Int32
+	barnConfig := multiCameraConfigHandler("front", "shed")
+	barn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if barnDown.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/api/events/front/doorbell/create" {
+			barnCreates.Add(1)
+			fmt.Fprintln(w, `{"success":true,"message":"Event created successfully","event_id":"barn-1"}`)
+			return
+		}
+		barnConfig(w, r)
+	}))
+	defer barn.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"instances":[
+		{"name":"house","url":"`+house.URL+`"},
+		{"name":"barn","url":"`+barn.URL+`"}
+	]}`)
+
+	env := newTestEnv(t)
+
+	app1 := startPlugin(t, env)
+
+	store := env.Storage()
+	for _, id := range []string{"house_front", "barn_front", "barn_shed"} {
+		if device := getDevice(t, store, frigateapp.PluginID, id); device.ID != id {
+			t.Fatalf("device %s = %+v", id, device)
+		}
+		getEntity(t, store, frigateapp.PluginID, id, "camera-state")
+	}
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "front"}); err == nil {
+		t.Fatal("named instances must not create un-namespaced devices")
+	}
+
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".barn_front.manual-event.command.frigate_create_event", []byte(`{"label":"doorbell"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("create event request: %v", err)
+	}
+	var created frigateapp.ManualEventResult
+	if err := json.Unmarshal(resp.Data, &created); err != nil {
+		t.Fatalf("unmarshal create reply: %v", err)
+	}
+	if !created.OK || created.EventID != "barn-1" || created.Camera != "front" || barnCreates.Load() != 1 {
+		t.Fatalf("create reply = %+v (barn creates %d), want routed to barn", created, barnCreates.Load())
+	}
+	manual := getEntity(t, store, frigateapp.PluginID, "barn_front", "manual-event").State.(frigateapp.ManualEventState)
+	if manual.LastEventID != "barn-1" {
+		t.Fatalf("barn_front manual event = %+v", manual)
+	}
+	app1.OnShutdown()
+
+	barnDown.Store(true)
+
+	startApp(t, env)
+
+	for _, id := range []string{"house_front", "barn_front", "barn_shed"} {
+		getDevice(t, store, frigateapp.PluginID, id)
+	}
+}
+
+func TestInstancesInheritSettingsAndRemoveOrphans(t *testing.T) {
+	house := httptest.NewServer(multiCameraConfigHandler("front", "shed"))
+	defer house.Close()
+
+	t.Setenv("FRIGATE_URL", house.URL)
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	startPlugin(t, env).OnShutdown()
+	getDevice(t, store, frigateapp.PluginID, "front")
+	getDevice(t, store, frigateapp.PluginID, "shed")
+
+	// The same server moves under instances; the top-level camera filter
+	// still applies to it. The bare devices are orphaned and go through the
+	// deletion rules.
+	t.Setenv("FRIGATE_URL", "")
+	t.Setenv("FRIGATE_CONFIG", `{"cameras":{"exclude":["shed"]},"deletion":{"max_ratio":0.7},"instances":[{"name":"house","url":"`+house.URL+`"}]}`)
+	startPlugin(t, env).OnShutdown()
+
+	getDevice(t, store, frigateapp.PluginID, "house_front")
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "house_shed"}); err == nil {
+		t.Fatal("house_shed exists, want the top-level exclude inherited")
+	}
+	for _, device := range []string{"front", "shed"} {
+		getDevice(t, store, frigateapp.PluginID, device)
+		if getEntity(t, store, frigateapp.PluginID, device, "availability").State.(frigateapp.AvailabilityState).Available {
+			t.Fatalf("orphaned %s still available", device)
+		}
+	}
+
+	// Later reconciles run out the grace period.
+	fire := make(chan time.Time)
+	app := startPlugin(t, env, func(a *frigateapp.App) {
+		a.SetAfter(func(time.Duration) <-chan time.Time { return fire })
+	})
+	waitFor(t, func() bool {
+		select {
+		case fire <- time.Now():
+		default:
+		}
+		_, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "shed"})
+		return err != nil
+	})
+	app.OnShutdown()
+	for _, device := range []string{"front", "shed"} {
+		stale, err := store.Search(frigateapp.PluginID + "." + device + ".>")
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: device}); err == nil || len(stale) != 0 {
+			t.Fatalf("un-namespaced %s left behind (%d entities)", device, len(stale))
+		}
+	}
+	getDevice(t, store, frigateapp.PluginID, "house_front")
+
+	t.Setenv("FRIGATE_CONFIG", `{"go2rtc_url":"http://127.0.0.1:1984","mqtt":{"host":"broker"},"instances":[{"name":"house","url":"`+house.URL+`"}]}`)
+	startPlugin(t, env).OnShutdown()
+	diag := getEntity(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID, "diagnostics").State.(frigateapp.DiagnosticsState)
+	if diag.Valid || len(diag.Errors) != 2 {
+		t.Fatalf("diagnostics = %+v, want go2rtc_url and mqtt rejected next to instances", diag)
+	}
+
+	t.Setenv("FRIGATE_CONFIG", `{"instances":[{"name":"house","url":"`+house.URL+`"},{"name":"garden"}]}`)
+	startPlugin(t, env).OnShutdown()
+	diag = getEntity(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID, "diagnostics").State.(frigateapp.DiagnosticsState)
+	if diag.Valid || len(diag.Errors) != 1 || diag.Errors[0] != `instance "garden": url is required` {
+		t.Fatalf("diagnostics = %+v, want the instance without url reported", diag)
+	}
+}
@@ -0,0 +1,63 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestLabelAliasesAndGroups(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","labels":{
+		"aliases":{"person":"people","lorry":"truck"},
+		"groups":{"vehicle":["car","truck","motorcycle"]}
+	}}`)
+
+	env := newTestEnv(t)
+
+	app := startApp(t, env)
+
+	store := env.Storage()
+
+	if _, err := store.Get(domain.EntityKey{Plugin: frigateapp.PluginID, DeviceID: "front", ID: "event-person"}); err == nil {
+		t.Fatal("aliased label person should not get its own entity")
+	}
+	people := getEntity(t, store, frigateapp.PluginID, "front", "event-people")
+	if people.Name != "People Events" {
+		t.Fatalf("event-people name = %q, want People Events", people.Name)
+	}
+	if occupancy := getEntity(t, store, frigateapp.PluginID, "front", "group-vehicle-occupancy").State.(frigateapp.StatusSensorState); occupancy.Occupancy != "Clear" {
+		t.Fatalf("vehicle occupancy before events = %+v, want Clear", occupancy)
+	}
+
+	for _, payload := range []string{
+		`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front","start_time":1710000000}}`,
+		`{"type":"new","after":{"id":"evt-2","label":"lorry","camera":"front","start_time":1710000010}}`,
+		`{"type":"new","after":{"id":"evt-3","label":"car","camera":"front","start_time":1710000020}}`,
+		`{"type":"end","after":{"id":"evt-3","label":"car","camera":"front","start_time":1710000020,"end_time":1710000030}}`,
+	} {
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+
+	if state := getEntity(t, store, frigateapp.PluginID, "front", "event-people").State.(frigateapp.EventSensorState); state.LastEventID != "evt-1" || state.Label != "people" {
+		t.Fatalf("event-people = %+v, want evt-1 labelled people", state)
+	}
+	getEntity(t, store, frigateapp.PluginID, "front", "event-truck")
+
+	count := getEntity(t, store, frigateapp.PluginID, "front", "group-vehicle-count").State.(frigateapp.StatusSensorState)
+	active := getEntity(t, store, frigateapp.PluginID, "front", "group-vehicle-active-count").State.(frigateapp.StatusSensorState)
+	occupancy := getEntity(t, store, frigateapp.PluginID, "front", "group-vehicle-occupancy").State.(frigateapp.StatusSensorState)
+	if count.Count != 2 || active.ActiveCount != 1 || occupancy.Occupancy != "Detected" {
+		t.Fatalf("vehicle group = count %+v, active %+v, occupancy %+v", count, active, occupancy)
+	}
+	event := getEntity(t, store, frigateapp.PluginID, "front", "group-vehicle-event").State.(frigateapp.EventSensorState)
+	if event.LastEventID != "evt-3" || !event.EventPresent {
+		t.Fatalf("vehicle event = %+v, want evt-3 with a vehicle present", event)
+	}
+}
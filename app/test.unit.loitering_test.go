@@ -0,0 +1,155 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+func TestLoiteringSensorAndEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/config" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"cameras":{"porch":{"name":"porch","enabled":true,
+			"detect":{"enabled":true},"objects":{"track":["person"]},
+			"zones":{
+				"steps":{"coordinates":"0,0,1,1","loitering_time":30},
+				"lawn":{"coordinates":"1,1,2,2"}
+			}}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`"}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	events := make(chan frigateapp.LoiteringEvent, 4)
+	sub, err := env.Messenger().Subscribe(frigateapp.PluginID+".porch.loitering-steps.event.loitering", func(msg *messenger.Message) {
+		var event frigateapp.LoiteringEvent
+		if err := json.Unmarshal(msg.Data, &event); err == nil {
+			events <- event
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := env.Messenger().Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	clock := newTestClock(time.Unix(1710000000, 0))
+	app := startApp(t, env, withClock(clock))
+
+	loitering := func() bool {
+		return getEntity(t, store, frigateapp.PluginID, "porch", "loitering-steps").State.(domain.BinarySensor).On
+	}
+	if _, err := store.Get(domain.EntityKey{Plugin: frigateapp.PluginID, DeviceID: "porch", ID: "loitering-lawn"}); err == nil {
+		t.Fatal("zone without loitering_time should not get a loitering sensor")
+	}
+	if loitering() {
+		t.Fatal("loitering-steps should start off")
+	}
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"porch","start_time":1710000000,"current_zones":["steps"],"pending_loitering":true,"max_severity":"alert"}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(new): %v", err)
+	}
+	clock.Advance(31 * time.Second)
+
+	select {
+	case event := <-events:
+		want := frigateapp.LoiteringEvent{Camera: "porch", Zone: "steps", Label: "person", EventID: "evt-1", DurationSeconds: 31, MaxSeverity: "alert"}
+		if event != want {
+			t.Fatalf("loitering event = %+v, want %+v", event, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no loitering event published")
+	}
+	waitFor(t, loitering)
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"update","after":{"id":"evt-1","label":"person","camera":"porch","start_time":1710000000,"current_zones":["lawn"]}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(update): %v", err)
+	}
+	if loitering() {
+		t.Fatal("loitering-steps should turn off once the person leaves the zone")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected second loitering event %+v", event)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestLoiteringSurvivesRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/events" && r.URL.Query().Get("in_progress") == "1":
+			w.Write([]byte(`[{"id":"evt-1","label":"person","camera":"porch","start_time":1710000000,"current_zones":["steps"]}]`))
+		case r.URL.Path == "/api/config":
+			w.Write([]byte(`{"cameras":{"porch":{"name":"porch","enabled":true,
+				"detect":{"enabled":true},"objects":{"track":["person"]},
+				"zones":{"steps":{"coordinates":"0,0,1,1","loitering_time":30}}}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`"}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	events := make(chan frigateapp.LoiteringEvent, 4)
+	sub, err := env.Messenger().Subscribe(frigateapp.PluginID+".porch.loitering-steps.event.loitering", func(msg *messenger.Message) {
+		var event frigateapp.LoiteringEvent
+		if err := json.Unmarshal(msg.Data, &event); err == nil {
+			events <- event
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := env.Messenger().Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	clock := newTestClock(time.Unix(1710000000, 0))
+	app := startPlugin(t, env, withClock(clock))
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"porch","start_time":1710000000,"current_zones":["steps"]}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(new): %v", err)
+	}
+	clock.Advance(20 * time.Second)
+	app.OnShutdown()
+
+	// The person has been on the steps for 31s in total across the restart.
+	app = startPlugin(t, env, withClock(clock))
+	clock.Advance(11 * time.Second)
+	select {
+	case event := <-events:
+		if event.EventID != "evt-1" || event.DurationSeconds != 31 {
+			t.Fatalf("loitering event = %+v, want evt-1 after 31s", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no loitering event published after the restart")
+	}
+	app.OnShutdown()
+
+	startApp(t, env, withClock(clock))
+	if !getEntity(t, store, frigateapp.PluginID, "porch", "loitering-steps").State.(domain.BinarySensor).On {
+		t.Fatal("loitering-steps should stay on after a restart")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("loitering event %+v announced again after a restart", event)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
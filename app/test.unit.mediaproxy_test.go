@@ -0,0 +1,86 @@
+package app_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestMediaProxyServesSignedCachedSnapshots(t *testing.T) {
+	var latestCalls, eventCalls atomic.Int32
+	config := singleCameraConfigHandler("front_door")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "hunter2" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/front_door/latest.jpg":
+			latestCalls.Add(1)
+			w.Write([]byte("latest-jpeg"))
+		case "/api/events/evt-1/snapshot.jpg":
+			eventCalls.Add(1)
+			w.Write([]byte("event-jpeg"))
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{
+		"url":"`+server.URL+`","username":"admin","password":"hunter2",
+		"media":{"listen":"127.0.0.1:0","cache_dir":"`+t.TempDir()+`","latest_ttl_seconds":60}
+	}`)
+
+	env := newTestEnv(t)
+
+	app := startApp(t, env)
+
+	store := env.Storage()
+	latest := getEntity(t, store, frigateapp.PluginID, "front_door", "image-latest").State.(frigateapp.ImageState)
+	if strings.HasPrefix(latest.URL, server.URL) || !strings.Contains(latest.URL, "/media/front_door/latest.jpg?exp=") {
+		t.Fatalf("latest URL = %q, want signed proxy URL", latest.URL)
+	}
+
+	for i := 0; i < 2; i++ {
+		if body := fetchBody(t, latest.URL, http.StatusOK); body != "latest-jpeg" {
+			t.Fatalf("proxied latest body = %q", body)
+		}
+	}
+	if latestCalls.Load() != 1 {
+		t.Fatalf("Frigate latest.jpg calls = %d, want 1 (second served from cache)", latestCalls.Load())
+	}
+
+	fetchBody(t, strings.Replace(latest.URL, "sig=", "sig=00", 1), http.StatusForbidden)
+	fetchBody(t, strings.Replace(latest.URL, "latest.jpg", "events/evt-1/snapshot.jpg", 1), http.StatusForbidden)
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front_door","start_time":1710000000,"has_snapshot":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent: %v", err)
+	}
+	snapshot := getEntity(t, store, frigateapp.PluginID, "front_door", "image-person-snapshot").State.(frigateapp.ImageState)
+	if body := fetchBody(t, snapshot.URL, http.StatusOK); body != "event-jpeg" {
+		t.Fatalf("proxied event snapshot body = %q", body)
+	}
+	if eventCalls.Load() != 1 {
+		t.Fatalf("Frigate event snapshot calls = %d, want 1", eventCalls.Load())
+	}
+}
+
+func fetchBody(t *testing.T, url string, wantStatus int) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("GET %s: status %d, want %d (%s)", url, resp.StatusCode, wantStatus, body)
+	}
+	return string(body)
+}
@@ -0,0 +1,121 @@
+package app_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestOccupancyDebounceAndThresholds(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","occupancy":{
+		"clear_delay_seconds":30,
+		"min_score":0.6,
+		"labels":{"car":{"ignore_stationary":true}},
+		"cameras":{"front":{"labels":{"person":{"on_delay_seconds":5},"car":{"clear_delay_seconds":0}}}}
+	}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	clock := newTestClock(time.Unix(1710000000, 0))
+	app := startApp(t, env, withClock(clock))
+
+	send := func(payload string) {
+		t.Helper()
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+	occupancy := func() string {
+		t.Helper()
+		return getEntity(t, store, frigateapp.PluginID, "front", "status-all-occupancy").State.(frigateapp.StatusSensorState).Occupancy
+	}
+
+	send(`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front","start_time":1710000000,"top_score":0.8}}`)
+	if got := occupancy(); got != "Clear" {
+		t.Fatalf("occupancy inside the on delay = %q, want Clear", got)
+	}
+	clock.Advance(6 * time.Second)
+	waitFor(t, func() bool { return occupancy() == "Detected" })
+
+	send(`{"type":"end","after":{"id":"evt-1","label":"person","camera":"front","start_time":1710000000,"end_time":1710000006,"top_score":0.8}}`)
+	if got := occupancy(); got != "Detected" {
+		t.Fatalf("occupancy inside the clear delay = %q, want Detected", got)
+	}
+	clock.Advance(31 * time.Second)
+	waitFor(t, func() bool { return occupancy() == "Clear" })
+
+	send(`{"type":"new","after":{"id":"evt-2","label":"car","camera":"front","start_time":1710000040,"top_score":0.9,"stationary":true,"motionless_count":200}}`)
+	send(`{"type":"new","after":{"id":"evt-3","label":"car","camera":"front","start_time":1710000041,"score":0.4}}`)
+	if got := occupancy(); got != "Clear" {
+		t.Fatalf("occupancy with a parked car and a low score = %q, want Clear", got)
+	}
+	active := getEntity(t, store, frigateapp.PluginID, "front", "status-all-active-count").State.(frigateapp.StatusSensorState)
+	if active.ActiveCount != 2 {
+		t.Fatalf("active count = %d, want filtered events still counted", active.ActiveCount)
+	}
+	send(`{"type":"update","after":{"id":"evt-2","label":"car","camera":"front","start_time":1710000040,"top_score":0.9,"stationary":false}}`)
+	if got := occupancy(); got != "Detected" {
+		t.Fatalf("occupancy once the car moves = %q, want Detected", got)
+	}
+
+	// The camera's explicit zero clear delay wins over the default 30s.
+	send(`{"type":"end","after":{"id":"evt-2","label":"car","camera":"front","start_time":1710000040,"end_time":1710000045,"top_score":0.9}}`)
+	send(`{"type":"end","after":{"id":"evt-3","label":"car","camera":"front","start_time":1710000041,"end_time":1710000045,"score":0.4}}`)
+	if got := occupancy(); got != "Clear" {
+		t.Fatalf("occupancy once the cars leave = %q, want Clear without a delay", got)
+	}
+}
+
+func TestStationaryAndMovingObjects(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("street"))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","occupancy":{"ignore_stationary":true,"recently_arrived_seconds":120}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	clock := newTestClock(time.Unix(1710000010, 0))
+	app := startApp(t, env, withClock(clock))
+
+	for _, payload := range []string{
+		`{"type":"new","after":{"id":"evt-1","label":"car","camera":"street","start_time":1710000000,"stationary":true,"motionless_count":40}}`,
+		`{"type":"new","after":{"id":"evt-2","label":"car","camera":"street","start_time":1710000005}}`,
+		`{"type":"end","after":{"id":"evt-2","label":"car","camera":"street","start_time":1710000005,"end_time":1710000009}}`,
+		`{"type":"new","after":{"id":"evt-3","label":"person","camera":"street","start_time":1710000008}}`,
+		`{"type":"end","after":{"id":"evt-3","label":"person","camera":"street","start_time":1710000008,"end_time":1710000009}}`,
+	} {
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+
+	cars := getEntity(t, store, frigateapp.PluginID, "street", "objects-car").State.(frigateapp.ObjectCountsState)
+	if cars.Moving != 0 || cars.Stationary != 1 || cars.Value != "0 moving, 1 stationary" {
+		t.Fatalf("objects-car = %+v, want one stationary car", cars)
+	}
+	occupancy := func() string {
+		return getEntity(t, store, frigateapp.PluginID, "street", "status-all-occupancy").State.(frigateapp.StatusSensorState).Occupancy
+	}
+	if got := occupancy(); got != "Detected" {
+		t.Fatalf("occupancy with a recently arrived car = %q, want Detected", got)
+	}
+
+	if err := app.HandleMQTTEvent([]byte(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"street","start_time":1710000000,"stationary":false}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(update): %v", err)
+	}
+	cars = getEntity(t, store, frigateapp.PluginID, "street", "objects-car").State.(frigateapp.ObjectCountsState)
+	if cars.Moving != 1 || cars.Stationary != 0 {
+		t.Fatalf("objects-car after it moved = %+v, want one moving car", cars)
+	}
+	if err := app.HandleMQTTEvent([]byte(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"street","start_time":1710000000,"stationary":true}}`)); err != nil {
+		t.Fatalf("HandleMQTTEvent(update): %v", err)
+	}
+
+	clock.Advance(3 * time.Minute)
+	waitFor(t, func() bool { return occupancy() == "Clear" })
+}
@@ -0,0 +1,61 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestStaleActiveEventsAreReaped(t *testing.T) {
+	config := multiCameraConfigHandler("front")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/events/evt-lost":
+			http.NotFound(w, r)
+		case "/api/events/evt-parked":
+			w.Write([]byte(`{"id":"evt-parked","label":"person","camera":"front","start_time":1710000010}`))
+		case "/api/events/evt-ended":
+			w.Write([]byte(`{"id":"evt-ended","label":"person","camera":"front","start_time":1710000020,"end_time":1710000030,"has_clip":true}`))
+		default:
+			config(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","stale_events":{"max_age_seconds":60,"interval_seconds":1}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	clock := newTestClock(time.Unix(1710000000, 0))
+	app := startApp(t, env, withClock(clock))
+
+	for _, payload := range []string{
+		`{"type":"new","after":{"id":"evt-lost","label":"person","camera":"front","start_time":1710000000}}`,
+		`{"type":"new","after":{"id":"evt-parked","label":"person","camera":"front","start_time":1710000010}}`,
+		`{"type":"new","after":{"id":"evt-ended","label":"person","camera":"front","start_time":1710000020}}`,
+	} {
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+	clock.Advance(2 * time.Minute)
+
+	waitFor(t, func() bool {
+		reaped := getEntity(t, store, frigateapp.PluginID, "front", "reaped-events").State.(frigateapp.StatusSensorState)
+		return reaped.Count == 2
+	})
+	active := getEntity(t, store, frigateapp.PluginID, "front", "status-all-active-count").State.(frigateapp.StatusSensorState)
+	if active.ActiveCount != 1 {
+		t.Fatalf("active count after reaping = %d, want the in-progress event kept", active.ActiveCount)
+	}
+	if occupancy := getEntity(t, store, frigateapp.PluginID, "front", "status-all-occupancy").State.(frigateapp.StatusSensorState); occupancy.Occupancy != "Detected" {
+		t.Fatalf("occupancy = %q, want Detected while evt-parked is in progress", occupancy.Occupancy)
+	}
+	event := getEntity(t, store, frigateapp.PluginID, "front", "event-person").State.(frigateapp.EventSensorState)
+	if event.LastEventID != "evt-ended" || !event.HasClip {
+		t.Fatalf("event-person = %+v, want the ended event from Frigate", event)
+	}
+}
@@ -0,0 +1,176 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestReconcileCommandReportsDiff(t *testing.T) {
+	var cameras atomic.Pointer[[]string]
+	var frontDetect atomic.Bool
+	initial := []string{"back", "front"}
+	cameras.Store(&initial)
+	frontDetect.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/config" {
+			http.NotFound(w, r)
+			return
+		}
+		cams := make(map[string]any)
+		for _, name := range *cameras.Load() {
+			cams[name] = map[string]any{
+				"name":    name,
+				"enabled": true,
+				"detect":  map[string]any{"enabled": name != "front" || frontDetect.Load()},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"cameras": cams})
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","deletion":{"grace_reconciles":1}}`)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	button := getEntity(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID, "reconcile")
+	if len(button.Commands) != 1 || button.Commands[0] != "frigate_reconcile" {
+		t.Fatalf("reconcile entity commands = %v", button.Commands)
+	}
+
+	reconcile := func() frigateapp.ReconcileResult {
+		t.Helper()
+		resp, err := env.Messenger().Request(frigateapp.PluginID+"."+frigateapp.PluginDeviceID+".reconcile.command.frigate_reconcile", []byte(`{}`), 5*time.Second)
+		if err != nil {
+			t.Fatalf("reconcile request: %v", err)
+		}
+		var result frigateapp.ReconcileResult
+		if err := json.Unmarshal(resp.Data, &result); err != nil {
+			t.Fatalf("unmarshal reconcile reply: %v", err)
+		}
+		if !result.OK {
+			t.Fatalf("reconcile reply = %+v", result)
+		}
+		return result
+	}
+
+	if result := reconcile(); len(result.CamerasAdded)+len(result.CamerasRemoved)+len(result.CamerasChanged) != 0 {
+		t.Fatalf("unchanged Frigate config reported %+v", result.ReconcileDiff)
+	}
+
+	next := []string{"front", "side"}
+	cameras.Store(&next)
+	frontDetect.Store(false)
+
+	result := reconcile()
+	if !reflect.DeepEqual(result.CamerasAdded, []string{"side"}) {
+		t.Fatalf("cameras added = %v, want [side]", result.CamerasAdded)
+	}
+	if !reflect.DeepEqual(result.CamerasRemoved, []string{"back"}) {
+		t.Fatalf("cameras removed = %v, want [back]", result.CamerasRemoved)
+	}
+	if !reflect.DeepEqual(result.CamerasChanged, []string{"front"}) {
+		t.Fatalf("cameras changed = %v, want [front]", result.CamerasChanged)
+	}
+	if !slices.Contains(result.EntitiesChanged, "front.camera-state") {
+		t.Fatalf("entities changed = %v, want front.camera-state", result.EntitiesChanged)
+	}
+	if !slices.Contains(result.EntitiesAdded, "side.camera-state") || !slices.Contains(result.EntitiesRemoved, "back.camera-state") {
+		t.Fatalf("entity diff = %+v", result.ReconcileDiff)
+	}
+	getDevice(t, store, frigateapp.PluginID, "side")
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "back"}); err == nil {
+		t.Fatal("back should be deleted")
+	}
+	getDevice(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID)
+}
+
+func TestReconcileIntervalFromEnv(t *testing.T) {
+	var cameras atomic.Pointer[[]string]
+	initial := []string{"front"}
+	cameras.Store(&initial)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiCameraConfigHandler(*cameras.Load()...)(w, r)
+	}))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","reconcile_jitter_seconds":1}`)
+	t.Setenv("FRIGATE_RECONCILE_INTERVAL", "1s")
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	next := []string{"front", "side"}
+	cameras.Store(&next)
+
+	store := env.Storage()
+	waitFor(t, func() bool {
+		_, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "side"})
+		return err == nil
+	})
+}
+
+func TestReconcileRunsAfterJitteredInterval(t *testing.T) {
+	var cameras atomic.Pointer[[]string]
+	initial := []string{"front"}
+	cameras.Store(&initial)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiCameraConfigHandler(*cameras.Load()...)(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","reconcile_interval_seconds":100,"reconcile_jitter_seconds":20}`)
+
+	waits := make(chan time.Duration, 16)
+	fire := make(chan time.Time)
+	env := newTestEnv(t)
+	startApp(t, env, func(a *frigateapp.App) {
+		a.SetAfter(func(d time.Duration) <-chan time.Time {
+			waits <- d
+			return fire
+		})
+	})
+	store := env.Storage()
+
+	next := func() time.Duration {
+		t.Helper()
+		select {
+		case d := <-waits:
+			if d < 100*time.Second || d >= 120*time.Second {
+				t.Fatalf("reconcile wait = %v, want 100s plus up to 20s of jitter", d)
+			}
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatal("reconcile loop did not schedule a wait")
+			return 0
+		}
+	}
+
+	seen := map[time.Duration]bool{next(): true}
+	if _, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "side"}); err == nil {
+		t.Fatal("side exists before Frigate reports it")
+	}
+	updated := []string{"front", "side"}
+	cameras.Store(&updated)
+	for i := 0; i < 4; i++ {
+		fire <- time.Now()
+		seen[next()] = true
+	}
+	getDevice(t, store, frigateapp.PluginID, "side")
+	if len(seen) < 2 {
+		t.Fatalf("reconcile waits = %v, want jitter to vary them", seen)
+	}
+}
@@ -0,0 +1,149 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+)
+
+func TestConfigFileReloadsLive(t *testing.T) {
+	first := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer first.Close()
+
+	var secondHits atomic.Int32
+	secondConfig := multiCameraConfigHandler("front", "side")
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/config" {
+			secondHits.Add(1)
+		}
+		secondConfig(w, r)
+	}))
+	defer second.Close()
+
+	t.Chdir(t.TempDir())
+	writeConfig := func(config string) {
+		t.Helper()
+		if err := os.WriteFile("config.json", []byte(config), 0o644); err != nil {
+			t.Fatalf("write config.json: %v", err)
+		}
+	}
+	writeConfig(`{"url":"` + first.URL + `"}`)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	getDevice(t, store, frigateapp.PluginID, "front")
+
+	writeConfig(`{"url":"` + second.URL + `"}`)
+	waitFor(t, func() bool {
+		_, err := store.Get(domain.DeviceKey{Plugin: frigateapp.PluginID, ID: "side"})
+		return err == nil
+	})
+
+	// A config that fails validation is rejected and the running one kept.
+	writeConfig(`{"url":"ftp://nvr.lan"}`)
+	time.Sleep(500 * time.Millisecond)
+	hits := secondHits.Load()
+	resp, err := env.Messenger().Request(frigateapp.PluginID+"."+frigateapp.PluginDeviceID+".reconcile.command.frigate_reconcile", []byte(`{}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("reconcile request: %v", err)
+	}
+	var result frigateapp.ReconcileResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal reconcile reply: %v", err)
+	}
+	if !result.OK || secondHits.Load() != hits+1 {
+		t.Fatalf("reconcile after bad config = %+v (hits %d -> %d), want second server still in use", result, hits, secondHits.Load())
+	}
+}
+
+func TestConfigDiagnosticsReportProblems(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+
+	t.Chdir(t.TempDir())
+	// config.json points at a dead server; the variable overrides it.
+	config := `{"url":"http://127.0.0.1:1","mqtt":{"topic_prefix":"frigate/#"}}`
+	if err := os.WriteFile("config.json", []byte(config), 0o644); err != nil {
+		t.Fatalf("write config.json: %v", err)
+	}
+	t.Setenv("FRIGATE_URL", server.URL)
+	t.Setenv("FRIGATE_TIMEOUT_MS", "5s")
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	getDevice(t, store, frigateapp.PluginID, "front")
+
+	diag := getEntity(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID, "diagnostics").State.(frigateapp.DiagnosticsState)
+	if diag.Valid || diag.Source != "config.json" || len(diag.Errors) != 2 {
+		t.Fatalf("diagnostics = %+v, want two errors from config.json", diag)
+	}
+	if !strings.Contains(diag.Errors[0], "FRIGATE_TIMEOUT_MS") || !strings.Contains(diag.Errors[1], "mqtt.topic_prefix") {
+		t.Fatalf("diagnostics errors = %q", diag.Errors)
+	}
+
+	if err := os.WriteFile("config.json", []byte(`{"url":"http://127.0.0.1:1"}`), 0o644); err != nil {
+		t.Fatalf("write config.json: %v", err)
+	}
+	waitFor(t, func() bool {
+		diag := getEntity(t, store, frigateapp.PluginID, frigateapp.PluginDeviceID, "diagnostics").State.(frigateapp.DiagnosticsState)
+		return diag.Rejected && len(diag.Errors) == 1
+	})
+}
+
+func TestMQTTEventsDuringReload(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+
+	t.Chdir(t.TempDir())
+	configs := []string{
+		`{"url":"` + server.URL + `","labels":{"aliases":{"human":"person"}}}`,
+		`{"url":"` + server.URL + `","occupancy":{"min_score":0.5}}`,
+	}
+	if err := os.WriteFile("config.json", []byte(configs[0]), 0o644); err != nil {
+		t.Fatalf("write config.json: %v", err)
+	}
+
+	env := newTestEnv(t)
+	app := startApp(t, env)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			payload := `{"type":"new","after":{"id":"evt-` + strconv.Itoa(i) + `","label":"human","camera":"front","start_time":1710000000,"top_score":0.8}}`
+			if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+				t.Errorf("HandleMQTTEvent: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 1; i <= 4; i++ {
+		if err := os.WriteFile("config.json", []byte(configs[i%2]), 0o644); err != nil {
+			t.Fatalf("write config.json: %v", err)
+		}
+		time.Sleep(400 * time.Millisecond)
+	}
+	close(done)
+	<-stopped
+}
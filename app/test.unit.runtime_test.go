@@ -0,0 +1,104 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestRuntimeSurvivesRestart(t *testing.T) {
+	config := multiCameraConfigHandler("front")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/events" && r.URL.Query().Get("in_progress") == "1" {
+			// evt-1 ended while the plugin was down and evt-3 started.
+			w.Write([]byte(`[
+				{"id":"evt-2","label":"person","camera":"front","start_time":1710000010},
+				{"id":"evt-3","label":"person","camera":"front","start_time":1710000020}
+			]`))
+			return
+		}
+		config(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`"}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	counts := func() (int, int) {
+		t.Helper()
+		count := getEntity(t, store, frigateapp.PluginID, "front", "status-all-count").State.(frigateapp.StatusSensorState)
+		active := getEntity(t, store, frigateapp.PluginID, "front", "status-all-active-count").State.(frigateapp.StatusSensorState)
+		return count.Count, active.ActiveCount
+	}
+
+	app := startPlugin(t, env)
+	for _, payload := range []string{
+		`{"type":"new","after":{"id":"evt-0","label":"person","camera":"front","start_time":1710000000}}`,
+		`{"type":"end","after":{"id":"evt-0","label":"person","camera":"front","start_time":1710000000,"end_time":1710000005}}`,
+		`{"type":"new","after":{"id":"evt-1","label":"person","camera":"front","start_time":1710000005}}`,
+		`{"type":"new","after":{"id":"evt-2","label":"person","camera":"front","start_time":1710000010}}`,
+	} {
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+	if count, active := counts(); count != 3 || active != 2 {
+		t.Fatalf("before restart count = %d, active = %d, want 3 and 2", count, active)
+	}
+	app.OnShutdown()
+
+	startApp(t, env)
+	if count, active := counts(); count != 4 || active != 2 {
+		t.Fatalf("after restart count = %d, active = %d, want 4 and 2", count, active)
+	}
+	event := getEntity(t, store, frigateapp.PluginID, "front", "event-person").State.(frigateapp.EventSensorState)
+	if event.LastEventID != "evt-3" {
+		t.Fatalf("event-person last event = %q, want evt-3", event.LastEventID)
+	}
+}
+
+type internalKey string
+
+func (k internalKey) Key() string { return string(k) }
+
+func TestRuntimeUpdatesAreSavedLaterAndOnShutdown(t *testing.T) {
+	server := httptest.NewServer(multiCameraConfigHandler("front"))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`"}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+	stored := func() string {
+		t.Helper()
+		data, err := store.GetInternal(internalKey(frigateapp.PluginID + ".runtime.front"))
+		if err != nil {
+			t.Fatalf("GetInternal: %v", err)
+		}
+		return string(data)
+	}
+
+	app := startPlugin(t, env)
+	send := func(payload string) {
+		t.Helper()
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+	send(`{"type":"new","after":{"id":"evt-1","label":"car","camera":"front","start_time":1710000000}}`)
+	if strings.Contains(stored(), "driveway") || !strings.Contains(stored(), "evt-1") {
+		t.Fatalf("runtime after new event = %s, want evt-1 stored at once", stored())
+	}
+	send(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"front","start_time":1710000000,"entered_zones":["driveway"]}}`)
+	if strings.Contains(stored(), "driveway") {
+		t.Fatalf("runtime after update = %s, want the update saved later", stored())
+	}
+
+	app.OnShutdown()
+	if !strings.Contains(stored(), "driveway") {
+		t.Fatalf("runtime after shutdown = %s, want the update flushed", stored())
+	}
+}
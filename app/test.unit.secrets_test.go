@@ -0,0 +1,87 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestCredentialsFromSecretFilesAndEnv(t *testing.T) {
+	var password atomic.Value
+	password.Store("first-s3cret")
+	config := multiCameraConfigHandler("front")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != password.Load().(string) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/create") {
+			// Frigate echoing the credentials back must not leak them.
+			http.Error(w, "rejected login admin:"+pass, http.StatusInternalServerError)
+			return
+		}
+		config(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	secretPath := filepath.Join(dir, "frigate_password")
+	if err := os.WriteFile(secretPath, []byte("first-s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	t.Setenv("TEST_FRIGATE_USER", "admin")
+	configJSON := `{"url":"` + server.URL + `","username":"${TEST_FRIGATE_USER}","password_file":"` + secretPath + `"}`
+	if err := os.WriteFile("config.json", []byte(configJSON), 0o644); err != nil {
+		t.Fatalf("write config.json: %v", err)
+	}
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	getDevice(t, store, frigateapp.PluginID, "front")
+
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front.manual-event.command.frigate_create_event", []byte(`{"label":"doorbell"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("create event request: %v", err)
+	}
+	var created frigateapp.ManualEventResult
+	if err := json.Unmarshal(resp.Data, &created); err != nil {
+		t.Fatalf("unmarshal create reply: %v", err)
+	}
+	manual := getEntity(t, store, frigateapp.PluginID, "front", "manual-event").State.(frigateapp.ManualEventState)
+	if created.OK || !strings.Contains(manual.LastError, "***") {
+		t.Fatalf("create reply = %+v, last error = %q, want a redacted failure", created, manual.LastError)
+	}
+	if strings.Contains(created.Error, "first-s3cret") || strings.Contains(manual.LastError, "first-s3cret") {
+		t.Fatalf("secret leaked: reply %q, last error %q", created.Error, manual.LastError)
+	}
+
+	// Rotating the secret file is picked up when config.json reloads.
+	password.Store("second-s3cret")
+	if err := os.WriteFile(secretPath, []byte("second-s3cret\n"), 0o600); err != nil {
+		t.Fatalf("rotate secret: %v", err)
+	}
+	if err := os.WriteFile("config.json", []byte(configJSON), 0o644); err != nil {
+		t.Fatalf("rewrite config.json: %v", err)
+	}
+	waitFor(t, func() bool {
+		resp, err := env.Messenger().Request(frigateapp.PluginID+"."+frigateapp.PluginDeviceID+".reconcile.command.frigate_reconcile", []byte(`{}`), 5*time.Second)
+		if err != nil {
+			return false
+		}
+		var result frigateapp.ReconcileResult
+		return json.Unmarshal(resp.Data, &result) == nil && result.OK
+	})
+}
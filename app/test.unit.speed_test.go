@@ -0,0 +1,154 @@
+package app_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+	domain "github.com/slidebolt/sb-domain"
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+func TestZoneSpeedSensorsAndSpeedingEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/config" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"ui":{"unit_system":"imperial"},"cameras":{"street":{"name":"street","enabled":true,
+			"detect":{"enabled":true},"objects":{"track":["car"]},
+			"zones":{
+				"road":{"coordinates":"0,0,1,1","distances":["10","12","10","12"]},
+				"sidewalk":{"coordinates":"1,1,2,2"}
+			}}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","counters":{"timezone":"UTC"},"speed":{"threshold":25,"zones":{"road":40}}}`)
+
+	env := newTestEnv(t)
+	store := env.Storage()
+
+	events := make(chan frigateapp.SpeedingEvent, 4)
+	sub, err := env.Messenger().Subscribe(frigateapp.PluginID+".street.speed-road-last.event.speeding", func(msg *messenger.Message) {
+		var event frigateapp.SpeedingEvent
+		if err := json.Unmarshal(msg.Data, &event); err == nil {
+			events <- event
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := env.Messenger().Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	clock := newTestClock(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	app := startApp(t, env, withClock(clock))
+
+	if _, err := store.Get(domain.EntityKey{Plugin: frigateapp.PluginID, DeviceID: "street", ID: "speed-sidewalk-last"}); err == nil {
+		t.Fatal("zone without distances should not get speed sensors")
+	}
+	speed := func(id string) domain.Sensor {
+		t.Helper()
+		return getEntity(t, store, frigateapp.PluginID, "street", id).State.(domain.Sensor)
+	}
+	send := func(payload string) {
+		t.Helper()
+		if err := app.HandleMQTTEvent([]byte(payload)); err != nil {
+			t.Fatalf("HandleMQTTEvent(%s): %v", payload, err)
+		}
+	}
+
+	send(`{"type":"new","after":{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"current_zones":["road"],"current_estimated_speed":30}}`)
+	send(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"current_zones":["road"],"current_estimated_speed":52,"average_estimated_speed":41}}`)
+	send(`{"type":"update","after":{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"current_zones":["road"],"current_estimated_speed":55,"average_estimated_speed":45}}`)
+	send(`{"type":"end","after":{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"end_time":1777636805}}`)
+	send(`{"type":"new","after":{"id":"evt-2","label":"car","camera":"street","start_time":1777636810,"current_zones":["road"],"current_estimated_speed":20}}`)
+
+	select {
+	case event := <-events:
+		want := frigateapp.SpeedingEvent{Camera: "street", Zone: "road", Label: "car", EventID: "evt-1", Speed: 52, AverageSpeed: 41, Threshold: 40, Unit: "mph"}
+		if event != want {
+			t.Fatalf("speeding event = %+v, want %+v", event, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no speeding event published")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected second speeding event %+v", event)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if last := speed("speed-road-last"); last.Value != 20.0 || last.Unit != "mph" || last.DeviceClass != "speed" {
+		t.Fatalf("speed-road-last = %+v, want 20 mph", last)
+	}
+	if top := speed("speed-road-max-today"); top.Value != 55.0 {
+		t.Fatalf("speed-road-max-today = %+v, want 55", top)
+	}
+
+	clock.Advance(24 * time.Hour)
+	send(`{"type":"update","after":{"id":"evt-2","label":"car","camera":"street","start_time":1777636810,"current_zones":["road"],"current_estimated_speed":18}}`)
+	if top := speed("speed-road-max-today"); top.Value != 18.0 {
+		t.Fatalf("speed-road-max-today on the next day = %+v, want 18", top)
+	}
+}
+
+func TestSpeedingIsNotAnnouncedAgainAfterRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/events" && r.URL.Query().Get("in_progress") == "1":
+			w.Write([]byte(`[{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"current_zones":["road"]}]`))
+		case r.URL.Path == "/api/config":
+			w.Write([]byte(`{"cameras":{"street":{"name":"street","enabled":true,
+				"detect":{"enabled":true},"objects":{"track":["car"]},
+				"zones":{"road":{"coordinates":"0,0,1,1","distances":["10","12","10","12"]}}}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","speed":{"threshold":40}}`)
+
+	env := newTestEnv(t)
+	events := make(chan frigateapp.SpeedingEvent, 4)
+	sub, err := env.Messenger().Subscribe(frigateapp.PluginID+".street.speed-road-last.event.speeding", func(msg *messenger.Message) {
+		var event frigateapp.SpeedingEvent
+		if err := json.Unmarshal(msg.Data, &event); err == nil {
+			events <- event
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := env.Messenger().Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	update := `{"type":"update","after":{"id":"evt-1","label":"car","camera":"street","start_time":1777636800,"current_zones":["road"],"current_estimated_speed":52}}`
+	app := startPlugin(t, env)
+	if err := app.HandleMQTTEvent([]byte(update)); err != nil {
+		t.Fatalf("HandleMQTTEvent: %v", err)
+	}
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no speeding event published")
+	}
+	app.OnShutdown()
+
+	app = startApp(t, env)
+	if err := app.HandleMQTTEvent([]byte(update)); err != nil {
+		t.Fatalf("HandleMQTTEvent after restart: %v", err)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("speeding event %+v announced again after a restart", event)
+	case <-time.After(time.Second):
+	}
+}
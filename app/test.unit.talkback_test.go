@@ -0,0 +1,116 @@
+package app_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+func TestTalkbackPlaysUploadedAudioThroughGo2RTC(t *testing.T) {
+	var mu sync.Mutex
+	var playDst, playSrc string
+
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/streams":
+			fmt.Fprintln(w, `{
+				"front_door": {"producers": [{"url": "rtsp://10.0.0.5/main", "medias": ["video, recvonly, H264", "audio, recvonly, PCMU/8000", "audio, sendonly, PCMU/8000"]}]},
+				"garage": {"producers": [{"url": "rtsp://10.0.0.6/main", "medias": ["video, recvonly, H264"]}]}
+			}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/streams":
+			mu.Lock()
+			playDst = r.URL.Query().Get("dst")
+			playSrc = r.URL.Query().Get("src")
+			mu.Unlock()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer go2rtc.Close()
+	server := httptest.NewServer(multiCameraConfigHandler("front_door", "garage"))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","go2rtc_url":"`+go2rtc.URL+`",
+		"media":{"listen":"127.0.0.1:0","cache_dir":"`+t.TempDir()+`"}}`)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	store := env.Storage()
+	door := getEntity(t, store, frigateapp.PluginID, "front_door", "stream-main")
+	if !door.State.(frigateapp.StreamState).Backchannel || !strings.Contains(strings.Join(door.Commands, ","), "frigate_talkback") {
+		t.Fatalf("front_door stream = %+v, want backchannel with talkback command", door)
+	}
+	garage := getEntity(t, store, frigateapp.PluginID, "garage", "stream-main")
+	if garage.State.(frigateapp.StreamState).Backchannel {
+		t.Fatalf("garage stream = %+v, want no backchannel", garage)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("RIFF-audio")), "format": "wav"})
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.stream-main.command.frigate_talkback", payload, 5*time.Second)
+	if err != nil {
+		t.Fatalf("talkback request: %v", err)
+	}
+	var result frigateapp.TalkbackResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal talkback: %v", err)
+	}
+	if !result.OK || result.Stream != "front_door" || result.Codec != "pcmu" {
+		t.Fatalf("talkback reply = %+v", result)
+	}
+
+	mu.Lock()
+	dst, src := playDst, playSrc
+	mu.Unlock()
+	if dst != "front_door" || !strings.HasPrefix(src, "ffmpeg:http://127.0.0.1:") || !strings.HasSuffix(src, "#audio=pcmu#input=file") {
+		t.Fatalf("play dst=%q src=%q", dst, src)
+	}
+	audioURL := strings.TrimSuffix(strings.TrimPrefix(src, "ffmpeg:"), "#audio=pcmu#input=file")
+	if body := fetchBody(t, audioURL, http.StatusOK); body != "RIFF-audio" {
+		t.Fatalf("uploaded audio = %q", body)
+	}
+
+	resp, err = env.Messenger().Request(frigateapp.PluginID+".garage.stream-main.command.frigate_talkback", []byte(`{"url":"http://tts.lan/hello.wav"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("garage talkback request: %v", err)
+	}
+	result = frigateapp.TalkbackResult{}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("unmarshal talkback: %v", err)
+	}
+	if result.OK || !strings.Contains(result.Error, "backchannel") {
+		t.Fatalf("garage talkback reply = %+v, want backchannel error", result)
+	}
+
+	for _, payload := range []string{
+		`{"url":"http://tts.lan/hello.wav#raw=-i /etc/passwd"}`,
+		`{"url":"http://tts.lan/hello.wav","codec":"pcmu#raw=-i /etc/passwd"}`,
+		`{"data":"UklGRg==","format":"wav#raw=-i"}`,
+	} {
+		resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.stream-main.command.frigate_talkback", []byte(payload), 5*time.Second)
+		if err != nil {
+			t.Fatalf("talkback request %s: %v", payload, err)
+		}
+		result = frigateapp.TalkbackResult{}
+		if err := json.Unmarshal(resp.Data, &result); err != nil {
+			t.Fatalf("unmarshal talkback: %v", err)
+		}
+		if result.OK || result.Error == "" {
+			t.Fatalf("talkback %s reply = %+v, want rejected", payload, result)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if playSrc != src {
+		t.Fatalf("rejected talkback reached go2rtc with src %q", playSrc)
+	}
+}
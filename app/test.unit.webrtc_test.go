@@ -0,0 +1,88 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	frigateapp "github.com/slidebolt/plugin-frigate/app"
+)
+
+const testAnswerSDP = "v=0\r\no=- 1 1 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:0\r\n" +
+	"a=candidate:1 1 udp 2130706431 192.168.1.20 8555 typ host\r\n" +
+	"a=candidate:2 1 tcp 1518280447 192.168.1.20 8555 typ host tcptype passive\r\n"
+
+func TestWebRTCOfferRelaysToGo2RTC(t *testing.T) {
+	var mu sync.Mutex
+	var gotSrc string
+	var gotOffer map[string]string
+
+	go2rtc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/streams":
+			fmt.Fprintln(w, `{"front_door": {"producers": []}, "front_door_sub": {"producers": []}}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/webrtc":
+			mu.Lock()
+			gotSrc = r.URL.Query().Get("src")
+			json.NewDecoder(r.Body).Decode(&gotOffer)
+			mu.Unlock()
+			json.NewEncoder(w).Encode(map[string]string{"type": "answer", "sdp": testAnswerSDP})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer go2rtc.Close()
+	server := httptest.NewServer(singleCameraConfigHandler("front_door"))
+	defer server.Close()
+
+	t.Setenv("FRIGATE_CONFIG", `{"url":"`+server.URL+`","go2rtc_url":"`+go2rtc.URL+`"}`)
+
+	env := newTestEnv(t)
+
+	startApp(t, env)
+
+	stream := getEntity(t, env.Storage(), frigateapp.PluginID, "front_door", "restream-html-sub")
+	if len(stream.Commands) != 1 || stream.Commands[0] != "frigate_webrtc_offer" {
+		t.Fatalf("stream commands = %v", stream.Commands)
+	}
+
+	offer, _ := json.Marshal(map[string]string{"sdp": "v=0\r\no=- 2 2 IN IP4 127.0.0.1\r\n"})
+	resp, err := env.Messenger().Request(frigateapp.PluginID+".front_door.restream-html-sub.command.frigate_webrtc_offer", offer, 5*time.Second)
+	if err != nil {
+		t.Fatalf("webrtc offer request: %v", err)
+	}
+	var answer frigateapp.WebRTCAnswer
+	if err := json.Unmarshal(resp.Data, &answer); err != nil {
+		t.Fatalf("unmarshal answer: %v", err)
+	}
+	if !answer.OK || answer.Type != "answer" || answer.SDP != testAnswerSDP || answer.Stream != "front_door_sub" {
+		t.Fatalf("answer = %+v", answer)
+	}
+	if len(answer.Candidates) != 2 || answer.Candidates[0].SDPMid != "0" ||
+		answer.Candidates[0].Candidate != "candidate:1 1 udp 2130706431 192.168.1.20 8555 typ host" {
+		t.Fatalf("candidates = %+v", answer.Candidates)
+	}
+
+	mu.Lock()
+	if gotSrc != "front_door_sub" || gotOffer["type"] != "offer" || gotOffer["sdp"] == "" {
+		t.Fatalf("go2rtc got src=%q offer=%v", gotSrc, gotOffer)
+	}
+	mu.Unlock()
+
+	resp, err = env.Messenger().Request(frigateapp.PluginID+".front_door.stream-main.command.frigate_webrtc_offer", []byte(`{"sdp":""}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("empty offer request: %v", err)
+	}
+	answer = frigateapp.WebRTCAnswer{}
+	if err := json.Unmarshal(resp.Data, &answer); err != nil {
+		t.Fatalf("unmarshal answer: %v", err)
+	}
+	if answer.OK || answer.Error == "" {
+		t.Fatalf("empty offer answer = %+v, want error", answer)
+	}
+}
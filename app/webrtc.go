@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	messenger "github.com/slidebolt/sb-messenger-sdk"
+)
+
+// CameraWebRTCOffer starts a WebRTC session for a stream entity. The plugin
+// relays the offer to go2rtc so clients only need the SlideBolt bus for
+// signaling.
+type CameraWebRTCOffer struct {
+	SDP string `json:"sdp"`
+}
+
+func (c CameraWebRTCOffer) validate() error {
+	if !strings.HasPrefix(strings.TrimSpace(c.SDP), "v=0") {
+		return fmt.Errorf("sdp offer is required")
+	}
+	return nil
+}
+
+// WebRTCCandidate is an ICE candidate in the form RTCPeerConnection's
+// addIceCandidate expects.
+type WebRTCCandidate struct {
+	Candidate string `json:"candidate"`
+	SDPMid    string `json:"sdp_mid,omitempty"`
+}
+
+// WebRTCAnswer is the reply to frigate_webrtc_offer. go2rtc gathers its
+// candidates before answering, so they are listed here as well as inside
+// the answer SDP for clients that only trickle.
+type WebRTCAnswer struct {
+	OK         bool              `json:"ok"`
+	Camera     string            `json:"camera"`
+	Stream     string            `json:"stream,omitempty"`
+	Type       string            `json:"type,omitempty"`
+	SDP        string            `json:"sdp,omitempty"`
+	Candidates []WebRTCCandidate `json:"candidates,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type webrtcSession struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
+
+func (c *Go2RTCClient) post(ctx context.Context, path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.APIBase+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+// WebRTCOffer exchanges an SDP offer for go2rtc's answer on stream src.
+func (c *Go2RTCClient) WebRTCOffer(ctx context.Context, src, offer string) (string, error) {
+	data, err := json.Marshal(webrtcSession{Type: "offer", SDP: offer})
+	if err != nil {
+		return "", fmt.Errorf("webrtc offer: %w", err)
+	}
+
+	resp, err := c.post(ctx, "/webrtc?src="+url.QueryEscape(src), "application/json", data)
+	if err != nil {
+		return "", fmt.Errorf("webrtc offer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("webrtc offer: HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var answer webrtcSession
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", fmt.Errorf("decode webrtc answer: %w", err)
+	}
+	if answer.SDP == "" {
+		return "", fmt.Errorf("webrtc offer: empty answer")
+	}
+	return answer.SDP, nil
+}
+
+// sdpCandidates lists the a=candidate lines of an SDP with the mid of the
+// media section they belong to.
+func sdpCandidates(sdp string) []WebRTCCandidate {
+	var candidates []WebRTCCandidate
+	mid := ""
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			mid = ""
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidates = append(candidates, WebRTCCandidate{
+				Candidate: strings.TrimPrefix(line, "a="),
+				SDPMid:    mid,
+			})
+		}
+	}
+	return candidates
+}
+
+// streamForEntity resolves a stream entity ID to its go2rtc stream name and
+// the spec the entity was built from.
+func (a *App) streamForEntity(camera, entityID string) (string, streamSpec, bool) {
+	a.mu.Lock()
+	catalog := a.streams
+	cameras := a.cameras
+	a.mu.Unlock()
+
+	for _, stream := range cameraStreams(camera, cameras, catalog) {
+		for _, spec := range a.streamSpecsFor(stream.Suffix) {
+			if spec.ID == entityID {
+				return stream.Name, spec, true
+			}
+		}
+	}
+	return "", streamSpec{}, false
+}
+
+func (a *App) handleWebRTCOffer(cameraID, entityID string, cmd CameraWebRTCOffer, msg *messenger.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result := WebRTCAnswer{Camera: cameraID}
+	if err := cmd.validate(); err != nil {
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+	stream, _, ok := a.streamForEntity(cameraID, entityID)
+	if !ok || a.go2rtc == nil {
+		result.Error = fmt.Sprintf("no go2rtc stream for %s.%s", cameraID, entityID)
+		reply(msg, result)
+		return
+	}
+	result.Stream = stream
+
+	answer, err := a.go2rtc.WebRTCOffer(ctx, stream, cmd.SDP)
+	if err != nil {
+		log.Printf("plugin-frigate: webrtc offer for %s failed: %v", stream, err)
+		result.Error = redactError(err)
+		reply(msg, result)
+		return
+	}
+
+	result.OK = true
+	result.Type = "answer"
+	result.SDP = answer
+	result.Candidates = sdpCandidates(answer)
+	reply(msg, result)
+}